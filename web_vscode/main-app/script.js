@@ -29,7 +29,7 @@ async function login() {
         });
 
         const data = await res.json();
-        if (!res.ok) throw new Error(data.error || "Login failed");
+        if (!res.ok) throw new Error(data.error?.message || "Login failed");
 
         // store JWT for later API calls
         localStorage.setItem("jwt", data.token);
@@ -11,7 +11,7 @@ export async function signup(email, password) {
     const data = await res.json();
     
     if (!res.ok) {
-      return { error: data.error || "Signup failed", success: false };
+      return { error: data.error?.message || "Signup failed", success: false };
     }
     
     return { success: true, message: data.message || "Signup successful" };
@@ -31,7 +31,7 @@ export async function login(email, password) {
     const data = await res.json();
     
     if (!res.ok) {
-      return { error: data.error || "Login failed", success: false };
+      return { error: data.error?.message || "Login failed", success: false };
     }
     
     // Store JWT token in localStorage
@@ -19,7 +19,7 @@ export async function listInstances() {
     const res = await fetch(`${BASE}/instances`, { headers });
     const data = await res.json();
 
-    if (!res.ok) throw new Error(data.error || "Failed to fetch instances");
+    if (!res.ok) throw new Error(data.error?.message || "Failed to fetch instances");
     return { success: true, instances: data };
   } catch (e) {
     return { success: false, error: e.message, instances: [] };
@@ -39,7 +39,7 @@ export async function createInstance(type, ttl_hours) {
     });
 
     const data = await res.json();
-    if (!res.ok) throw new Error(data.error || `Failed to create ${type}`);
+    if (!res.ok) throw new Error(data.error?.message || `Failed to create ${type}`);
 
     return { success: true, instance: data };
   } catch (e) {
@@ -59,7 +59,7 @@ export async function startInstance(id) {
     });
 
     const data = await res.json();
-    if (!res.ok) throw new Error(data.error || "Start failed");
+    if (!res.ok) throw new Error(data.error?.message || "Start failed");
 
     return { success: true };
   } catch (e) {
@@ -79,7 +79,7 @@ export async function stopInstance(id) {
     });
 
     const data = await res.json();
-    if (!res.ok) throw new Error(data.error || "Stop failed");
+    if (!res.ok) throw new Error(data.error?.message || "Stop failed");
 
     return { success: true };
   } catch (e) {
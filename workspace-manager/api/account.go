@@ -0,0 +1,403 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	db "example.com/m/v2/db/sqlc"
+	"example.com/m/v2/internal/logging"
+	"example.com/m/v2/internal/mailer"
+	"example.com/m/v2/util"
+)
+
+const (
+	purposeVerifyEmail   = "verify_email"
+	purposePasswordReset = "password_reset"
+
+	verifyEmailTTL   = 48 * time.Hour
+	passwordResetTTL = time.Hour
+
+	// mail is sent after the response so slow relays don't hold requests
+	// and response times don't reveal whether an address is registered
+	mailTimeout = 30 * time.Second
+
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+// AccountHandler serves account creation and the self-service flows that
+// go through email: address verification and password reset.
+type AccountHandler struct {
+	conn   *sql.DB
+	q      *db.Queries
+	mail   *mailer.Background
+	appURL string
+
+	signupOpen    bool
+	signupDomains []string
+}
+
+func NewAccountHandler(conn *sql.DB, q *db.Queries, m *mailer.Background, cfg *util.Config) *AccountHandler {
+	return &AccountHandler{
+		conn:          conn,
+		q:             q,
+		mail:          m,
+		appURL:        cfg.AppURL,
+		signupOpen:    cfg.SignupOpen,
+		signupDomains: cfg.SignupAllowedDomains,
+	}
+}
+
+var errSignupClosed = errors.New("signup requires an invite")
+
+// createUser creates a password account if signup policy admits the email:
+// open signup, an allowlisted domain, or a valid invite code, which is used
+// up in the same transaction.
+func (h *AccountHandler) createUser(ctx context.Context, email, pwHash, invite string) (db.Users, error) {
+	tx, err := h.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return db.Users{}, err
+	}
+	defer tx.Rollback()
+
+	qtx := h.q.WithTx(tx)
+
+	if !h.signupOpen && !h.domainAllowed(email) {
+		if invite == "" {
+			return db.Users{}, errSignupClosed
+		}
+		if _, err := qtx.UseSignupInvite(ctx, db.UseSignupInviteParams{
+			CodeHash: util.HashToken(invite),
+			Email:    sql.NullString{String: email, Valid: true},
+		}); errors.Is(err, sql.ErrNoRows) {
+			return db.Users{}, errSignupClosed
+		} else if err != nil {
+			return db.Users{}, err
+		}
+	}
+
+	u, err := qtx.CreateUser(ctx, db.CreateUserParams{
+		Email:    email,
+		Password: pwHash,
+	})
+	if err != nil {
+		return db.Users{}, err
+	}
+
+	return u, tx.Commit()
+}
+
+func (h *AccountHandler) domainAllowed(email string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+
+	for _, d := range h.signupDomains {
+		if domain == d {
+			return true
+		}
+	}
+	return false
+}
+
+func validEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Address == s
+}
+
+// normalizeEmail is applied to every email a client sends, so lookups and
+// uniqueness ignore case and stray whitespace.
+func normalizeEmail(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+// commonPasswords are rejected outright; they are the first guesses of any
+// credential stuffing run.
+var commonPasswords = map[string]bool{
+	"password":   true,
+	"password1":  true,
+	"12345678":   true,
+	"123456789":  true,
+	"1234567890": true,
+	"qwertyuiop": true,
+	"iloveyou":   true,
+	"sunshine":   true,
+	"football":   true,
+	"baseball":   true,
+	"letmein1":   true,
+	"welcome1":   true,
+	"ambilio1":   true,
+}
+
+// weakPassword responds with the policy violations and reports true if
+// password may not be used for the account with email.
+func weakPassword(c *gin.Context, password, email string) bool {
+	var problems []FieldError
+	add := func(msg string) {
+		problems = append(problems, FieldError{Field: "password", Message: msg})
+	}
+
+	lower := strings.ToLower(password)
+	distinct := map[rune]bool{}
+	for _, r := range password {
+		distinct[r] = true
+	}
+
+	switch {
+	case len(password) < minPasswordLength:
+		add("password must be at least 8 characters")
+	case len(password) > maxPasswordLength:
+		// bcrypt ignores everything after 72 bytes
+		add("password must be at most 72 bytes")
+	}
+	if len(distinct) < 4 {
+		add("password is too repetitive")
+	}
+	if commonPasswords[lower] {
+		add("password is too common")
+	}
+	if local, _, _ := strings.Cut(email, "@"); len(local) >= 3 && strings.Contains(lower, local) {
+		add("password must not contain your email address")
+	}
+
+	if len(problems) == 0 {
+		return false
+	}
+	respondErrorCode(c, 400, codeWeakPassword, problems[0].Message, problems)
+	return true
+}
+
+// sendTokenEmail issues a single-use token for purpose and mails a link
+// carrying it to u.
+func (h *AccountHandler) sendTokenEmail(ctx context.Context, u db.Users, purpose, template, path string, ttl time.Duration) error {
+	token, hash, err := util.NewToken()
+	if err != nil {
+		return err
+	}
+
+	if err := h.q.CreateEmailToken(ctx, db.CreateEmailTokenParams{
+		TokenHash: hash,
+		UserID:    u.ID,
+		Purpose:   purpose,
+		ExpiresAt: time.Now().Add(ttl),
+	}); err != nil {
+		return err
+	}
+
+	msg, err := mailer.Render(template, u.Email, map[string]any{
+		"Link":      h.appURL + path + "?token=" + url.QueryEscape(token),
+		"ExpiresIn": hoursText(ttl),
+	})
+	if err != nil {
+		return err
+	}
+
+	// the request's context is recycled once it returns
+	detached := logging.Detach(ctx)
+	h.mail.Go(func() {
+		ctx, cancel := context.WithTimeout(detached, mailTimeout)
+		defer cancel()
+
+		if err := h.mail.Send(ctx, msg); err != nil {
+			slog.ErrorContext(ctx, "sending email failed",
+				"purpose", purpose,
+				"recipient_id", u.ID,
+				"error", err,
+			)
+		}
+	})
+
+	return nil
+}
+
+func hoursText(d time.Duration) string {
+	if h := int(d.Hours()); h != 1 {
+		return strconv.Itoa(h) + " hours"
+	}
+	return "1 hour"
+}
+
+// SendVerification mails u a link to confirm their address.
+func (h *AccountHandler) SendVerification(ctx context.Context, u db.Users) error {
+	return h.sendTokenEmail(ctx, u, purposeVerifyEmail, "verify_email", "/verify-email", verifyEmailTTL)
+}
+
+func (h *AccountHandler) VerifyEmail(c *gin.Context) {
+	var req struct {
+		Token string `json:"token"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	tok, err := h.q.ConsumeEmailToken(c, db.ConsumeEmailTokenParams{
+		TokenHash: util.HashToken(req.Token),
+		Purpose:   purposeVerifyEmail,
+	})
+	if err != nil {
+		respondError(c, 400, "invalid or expired token")
+		return
+	}
+
+	if err := h.q.MarkEmailVerified(c, tok.UserID); err != nil {
+		serverError(c, err)
+		return
+	}
+	audit(c, h.q, uuid.NullUUID{UUID: tok.UserID, Valid: true}, auditEmailVerified, tok.UserID.String(), nil)
+
+	c.JSON(200, gin.H{"ok": true})
+}
+
+// ResendVerification sends the caller a fresh verification link.
+func (h *AccountHandler) ResendVerification(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		respondError(c, 401, "unauthorized")
+		return
+	}
+
+	u, err := h.q.GetUserByID(c, userID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	if u.EmailVerifiedAt.Valid {
+		respondError(c, 409, "email already verified")
+		return
+	}
+
+	if err := h.SendVerification(c, u); err != nil {
+		serverError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{"ok": true})
+}
+
+// ForgotPassword mails a reset link. It answers the same way whether or not
+// the address is registered.
+func (h *AccountHandler) ForgotPassword(c *gin.Context) {
+	var req struct {
+		Email string `json:"email"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	u, err := h.q.GetUserByEmail(c, normalizeEmail(req.Email))
+	if err == nil && !u.DisabledAt.Valid {
+		if err := h.sendTokenEmail(c, u, purposePasswordReset, "password_reset", "/reset-password", passwordResetTTL); err != nil {
+			serverError(c, err)
+			return
+		}
+	}
+
+	c.JSON(200, gin.H{"ok": true})
+}
+
+// ResetPassword sets a new password from a reset token and signs the user
+// out everywhere, revoking their API tokens too.
+func (h *AccountHandler) ResetPassword(c *gin.Context) {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	tx, err := h.conn.BeginTx(c, nil)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := h.q.WithTx(tx)
+
+	// a rejected password rolls back, leaving the token usable
+	tok, err := qtx.ConsumeEmailToken(c, db.ConsumeEmailTokenParams{
+		TokenHash: util.HashToken(req.Token),
+		Purpose:   purposePasswordReset,
+	})
+	if err != nil {
+		respondError(c, 400, "invalid or expired token")
+		return
+	}
+
+	u, err := qtx.GetUserByID(c, tok.UserID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	if weakPassword(c, req.Password, u.Email) {
+		return
+	}
+
+	pwHash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	if err := qtx.UpdateUserPassword(c, db.UpdateUserPasswordParams{
+		ID:       tok.UserID,
+		Password: string(pwHash),
+	}); err != nil {
+		serverError(c, err)
+		return
+	}
+
+	// other outstanding reset links die with this one
+	if err := qtx.InvalidateEmailTokens(c, db.InvalidateEmailTokensParams{
+		UserID:  tok.UserID,
+		Purpose: purposePasswordReset,
+	}); err != nil {
+		serverError(c, err)
+		return
+	}
+
+	// receiving the reset email proves the address too
+	if err := qtx.MarkEmailVerified(c, tok.UserID); err != nil {
+		serverError(c, err)
+		return
+	}
+
+	if err := qtx.RevokeUserSessions(c, tok.UserID); err != nil {
+		serverError(c, err)
+		return
+	}
+	if err := qtx.RevokeUserAPITokens(c, tok.UserID); err != nil {
+		serverError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		serverError(c, err)
+		return
+	}
+	audit(c, h.q, uuid.NullUUID{UUID: tok.UserID, Valid: true}, auditPasswordReset, tok.UserID.String(), nil)
+
+	c.JSON(200, gin.H{"ok": true})
+}
@@ -0,0 +1,413 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	db "example.com/m/v2/db/sqlc"
+	"example.com/m/v2/internal/docker"
+	"example.com/m/v2/internal/hoststats"
+	"example.com/m/v2/internal/webhook"
+	"example.com/m/v2/internal/worker"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+type AdminHandler struct {
+	q          *db.Queries
+	docker     *docker.DockerManager
+	sandboxes  *docker.AWSService
+	reconciler *worker.Reconciler
+}
+
+func NewAdminHandler(q *db.Queries, sandboxes *docker.AWSService) *AdminHandler {
+	d := docker.NewDockerManager()
+	return &AdminHandler{
+		q:          q,
+		docker:     d,
+		sandboxes:  sandboxes,
+		reconciler: worker.NewReconciler(q, d),
+	}
+}
+
+// pagination reads ?limit= and ?offset=, clamping limit to maxPageSize.
+func pagination(c *gin.Context) (int32, int32) {
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	offset, err := strconv.Atoi(c.Query("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	return int32(limit), int32(offset)
+}
+
+func queryString(c *gin.Context, key string) sql.NullString {
+	v := c.Query(key)
+	return sql.NullString{String: v, Valid: v != ""}
+}
+
+func queryUUID(c *gin.Context, key string) (uuid.NullUUID, bool) {
+	v := c.Query(key)
+	if v == "" {
+		return uuid.NullUUID{}, true
+	}
+	id, err := uuid.Parse(v)
+	if err != nil {
+		respondError(c, 400, "invalid "+key)
+		return uuid.NullUUID{}, false
+	}
+	return uuid.NullUUID{UUID: id, Valid: true}, true
+}
+
+// queryTime reads an RFC 3339 timestamp.
+func queryTime(c *gin.Context, key string) (sql.NullTime, bool) {
+	v := c.Query(key)
+	if v == "" {
+		return sql.NullTime{}, true
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		respondError(c, 400, "invalid "+key)
+		return sql.NullTime{}, false
+	}
+	return sql.NullTime{Time: t, Valid: true}, true
+}
+
+func (h *AdminHandler) ListInstances(c *gin.Context) {
+	userID, ok := queryUUID(c, "user_id")
+	if !ok {
+		return
+	}
+	orgID, ok := queryUUID(c, "org_id")
+	if !ok {
+		return
+	}
+
+	limit, offset := pagination(c)
+
+	instances, err := h.q.ListAllInstances(c, db.ListAllInstancesParams{
+		Status: queryString(c, "status"),
+		Type:   queryString(c, "type"),
+		UserID: userID,
+		OrgID:  orgID,
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	// admins manage instances without logging into their AWS consoles
+	for i := range instances {
+		instances[i] = withoutCredentials(instances[i])
+	}
+
+	c.JSON(200, instances)
+}
+
+func (h *AdminHandler) StopInstance(c *gin.Context) {
+	inst, ok := h.instance(c)
+	if !ok {
+		return
+	}
+
+	if inst.Type == "aws" {
+		respondError(c, 400, "aws instances cannot be stopped")
+		return
+	}
+
+	if err := h.docker.Stop(c, inst.ID.String(), inst.Type); err != nil {
+		serverError(c, err)
+		return
+	}
+	auditInstance(c, h.q, auditActor(c), inst, auditInstanceStopped, gin.H{"admin": true})
+
+	inst, err := h.q.UpdateInstanceStatus(c, db.UpdateInstanceStatusParams{
+		ID:     inst.ID,
+		Status: "stopped",
+	})
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	webhook.Notify(c, h.q, webhook.InstanceStopped, inst, map[string]any{"reason": "admin"})
+
+	c.JSON(200, inst)
+}
+
+// DeleteInstance tears down the instance's runtime resources and removes it.
+// Its data directory is only removed with ?purge_data=true.
+func (h *AdminHandler) DeleteInstance(c *gin.Context) {
+	inst, ok := h.instance(c)
+	if !ok {
+		return
+	}
+
+	if err := teardownInstance(c.Request.Context(), h.docker, h.sandboxes, inst, c.Query("purge_data") == "true"); err != nil {
+		serverError(c, err)
+		return
+	}
+
+	if err := h.q.DeleteInstance(c, inst.ID); err != nil {
+		serverError(c, err)
+		return
+	}
+	auditInstance(c, h.q, auditActor(c), inst, auditInstanceDeleted, gin.H{
+		"admin":      true,
+		"type":       inst.Type,
+		"purge_data": c.Query("purge_data") == "true",
+	})
+
+	c.JSON(200, gin.H{"ok": true})
+}
+
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	limit, offset := pagination(c)
+
+	users, err := h.q.ListUsers(c, db.ListUsersParams{
+		Email:  queryString(c, "email"),
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	c.JSON(200, users)
+}
+
+func (h *AdminHandler) DisableUser(c *gin.Context) {
+	h.setUserDisabled(c, true)
+}
+
+func (h *AdminHandler) EnableUser(c *gin.Context) {
+	h.setUserDisabled(c, false)
+}
+
+func (h *AdminHandler) setUserDisabled(c *gin.Context, disabled bool) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respondError(c, 400, "invalid user id")
+		return
+	}
+
+	if disabled && userID.String() == c.GetString("userID") {
+		respondError(c, 400, "cannot disable your own account")
+		return
+	}
+
+	u, err := h.q.SetUserDisabled(c, db.SetUserDisabledParams{
+		Disabled: disabled,
+		ID:       userID,
+	})
+	if err != nil {
+		respondError(c, 404, "user not found")
+		return
+	}
+
+	// a disabled user's refresh tokens and API tokens stop working for good;
+	// they log in again once re-enabled
+	if disabled {
+		if err := h.q.RevokeUserSessions(c, u.ID); err != nil {
+			serverError(c, err)
+			return
+		}
+		if err := h.q.RevokeUserAPITokens(c, u.ID); err != nil {
+			serverError(c, err)
+			return
+		}
+	}
+
+	action := auditUserEnabled
+	if disabled {
+		action = auditUserDisabled
+	}
+	auditSubject(c, h.q, auditActor(c), u.ID, action, u.Email, nil)
+
+	c.JSON(200, gin.H{
+		"id":          u.ID,
+		"email":       u.Email,
+		"disabled_at": u.DisabledAt,
+	})
+}
+
+// SetUserRole changes a user's platform role. Their existing tokens stop
+// working and they need to log in again.
+func (h *AdminHandler) SetUserRole(c *gin.Context) {
+	var req struct {
+		Role string `json:"role"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respondError(c, 400, "invalid user id")
+		return
+	}
+
+	if userID.String() == c.GetString("userID") {
+		respondError(c, 400, "cannot change your own role")
+		return
+	}
+
+	u, err := h.q.SetUserRole(c, db.SetUserRoleParams{
+		ID:   userID,
+		Role: req.Role,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(c, 404, "user not found")
+		return
+	}
+	if err != nil {
+		// role is a foreign key into roles
+		respondError(c, 400, "unknown role")
+		return
+	}
+	auditSubject(c, h.q, auditActor(c), u.ID, auditUserRoleChanged, u.Email, gin.H{"role": u.Role})
+
+	c.JSON(200, gin.H{
+		"id":    u.ID,
+		"email": u.Email,
+		"role":  u.Role,
+	})
+}
+
+func (h *AdminHandler) ListRoles(c *gin.Context) {
+	roles, err := h.q.ListRoles(c)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	perms, err := h.q.ListRolePermissions(c)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	byRole := map[string][]string{}
+	for _, p := range perms {
+		byRole[p.Role] = append(byRole[p.Role], p.Permission)
+	}
+
+	resp := make([]gin.H, 0, len(roles))
+	for _, r := range roles {
+		resp = append(resp, gin.H{
+			"name":        r.Name,
+			"description": r.Description,
+			"permissions": byRole[r.Name],
+		})
+	}
+
+	c.JSON(200, resp)
+}
+
+func (h *AdminHandler) HostUsage(c *gin.Context) {
+	usage, err := hoststats.Collect(dataRoot)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	containers, err := h.docker.ListWorkspaceContainers(c.Request.Context())
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	counts, err := h.q.CountInstancesByStatus(c)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"host":       usage,
+		"containers": len(containers),
+		"instances":  counts,
+	})
+}
+
+func (h *AdminHandler) Reconcile(c *gin.Context) {
+	report, err := h.reconciler.RunOnce(c.Request.Context())
+	if err != nil {
+		respondErrorCode(c, 500, codeInternal, err.Error(), report)
+		return
+	}
+	audit(c, h.q, auditActor(c), auditReconciled, "", gin.H{
+		"marked_stopped":     report.MarkedStopped,
+		"removed_containers": report.RemovedContainers,
+	})
+
+	c.JSON(200, report)
+}
+
+func (h *AdminHandler) instance(c *gin.Context) (db.Instances, bool) {
+	instanceID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respondError(c, 400, "invalid instance id")
+		return db.Instances{}, false
+	}
+
+	inst, err := h.q.GetInstanceByID(c, instanceID)
+	if err != nil {
+		respondError(c, 404, "instance not found")
+		return db.Instances{}, false
+	}
+
+	return inst, true
+}
+
+// teardownInstance releases what an instance holds outside the database: its
+// containers or AWS sandbox user, and with purgeData its data directory.
+func teardownInstance(ctx context.Context, d *docker.DockerManager, sandboxes *docker.AWSService, inst db.Instances, purgeData bool) error {
+	if inst.Type == "aws" {
+		if inst.AwsUsername.Valid {
+			if err := sandboxes.DeleteSandboxUser(ctx, inst.AwsUsername.String); err != nil {
+				return err
+			}
+		}
+	} else if err := d.Stop(ctx, inst.ID.String(), inst.Type); err != nil {
+		return err
+	}
+
+	if purgeData {
+		return removeDataPath(inst.EfsPath)
+	}
+	return nil
+}
+
+// removeDataPath deletes an instance data directory, refusing anything that
+// is not inside dataRoot.
+func removeDataPath(path string) error {
+	clean := filepath.Clean(path)
+	if !strings.HasPrefix(clean, dataRoot+string(filepath.Separator)) {
+		return os.ErrPermission
+	}
+	return os.RemoveAll(clean)
+}
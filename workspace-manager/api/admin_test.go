@@ -0,0 +1,56 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	db "example.com/m/v2/db/sqlc"
+)
+
+func TestAdminListInstancesHidesCredentials(t *testing.T) {
+	_, q := testDB(t)
+	owner := testUser(t, q)
+	admin := testUser(t, q)
+
+	const password = "console-password-1"
+	inst, err := q.CreateInstance(context.Background(), db.CreateInstanceParams{
+		ID:          uuid.New(),
+		UserID:      owner.ID,
+		Type:        "aws",
+		EfsPath:     "/tmp/" + uuid.NewString(),
+		TtlHours:    1,
+		ConsoleUrl:  sql.NullString{String: "https://console.example.com", Valid: true},
+		AwsUsername: sql.NullString{String: "sandbox-user", Valid: true},
+		AwsPassword: sql.NullString{String: password, Valid: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewAdminHandler(q, nil)
+	w := serve(t, "GET", "/admin/instances", "/admin/instances?user_id="+owner.ID.String(), nil,
+		testSession(t, q, admin, false), h.ListInstances)
+	if w.Code != 200 {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+
+	if strings.Contains(w.Body.String(), password) {
+		t.Errorf("response contains the console password: %s", w.Body)
+	}
+
+	var got []db.Instances
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != inst.ID {
+		t.Fatalf("instances = %+v, want just %s", got, inst.ID)
+	}
+	if got[0].AwsUsername.Valid || got[0].AwsPassword.Valid {
+		t.Errorf("credentials returned: %+v", got[0])
+	}
+}
@@ -0,0 +1,265 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	db "example.com/m/v2/db/sqlc"
+)
+
+const (
+	auditLoginSucceeded = "login.succeeded"
+	auditLoginFailed    = "login.failed"
+	auditLoginLocked    = "login.locked"
+	auditLogout         = "logout"
+	auditRefreshReused  = "session.refresh_token_reused"
+	auditSignupRejected = "signup.rejected"
+	auditSignedUp       = "signup.succeeded"
+	auditIdentityLinked = "sso.identity_linked"
+
+	auditEmailVerified   = "email.verified"
+	auditPasswordChanged = "password.changed"
+	auditPasswordReset   = "password.reset"
+	auditProfileUpdated  = "profile.updated"
+	auditAccountDeleted  = "account.deleted"
+
+	auditMFAEnrollStarted     = "mfa.enrollment_started"
+	auditMFAEnabled           = "mfa.enabled"
+	auditMFADisabled          = "mfa.disabled"
+	auditRecoveryCodesRenewed = "mfa.recovery_codes_regenerated"
+
+	auditTokenCreated = "token.created"
+	auditTokenRevoked = "token.revoked"
+
+	auditExportRequested  = "export.requested"
+	auditExportDownloaded = "export.downloaded"
+
+	auditInstanceCreated = "instance.created"
+	auditInstanceStarted = "instance.started"
+	auditInstanceStopped = "instance.stopped"
+	auditInstanceDeleted = "instance.deleted"
+	auditCredentialsRead = "instance.credentials_read"
+
+	auditMemberAdded   = "instance.member_added"
+	auditMemberUpdated = "instance.member_updated"
+	auditMemberRemoved = "instance.member_removed"
+
+	auditShareCreated = "share.created"
+	auditShareRevoked = "share.revoked"
+	auditShareOpened  = "share.opened"
+
+	auditOrgCreated       = "org.created"
+	auditOrgSwitched      = "org.switched"
+	auditOrgQuotaUpdated  = "org.quota_updated"
+	auditOrgMFAUpdated    = "org.mfa_updated"
+	auditOrgMemberAdded   = "org.member_added"
+	auditOrgMemberUpdated = "org.member_updated"
+	auditOrgMemberRemoved = "org.member_removed"
+
+	auditWebhookCreated       = "webhook.created"
+	auditWebhookUpdated       = "webhook.updated"
+	auditWebhookSecretRotated = "webhook.secret_rotated"
+	auditWebhookDeleted       = "webhook.deleted"
+	auditWebhookRedelivered   = "webhook.redelivered"
+
+	auditUserDisabled    = "user.disabled"
+	auditUserEnabled     = "user.enabled"
+	auditUserRoleChanged = "user.role_changed"
+	auditInviteCreated   = "invite.created"
+	auditInviteRevoked   = "invite.revoked"
+	auditReconciled      = "host.reconciled"
+	auditLogExported     = "audit.exported"
+)
+
+// audit records a security event. Failures are logged rather than returned
+// so auditing never breaks the request being audited.
+func audit(c *gin.Context, q *db.Queries, actor uuid.NullUUID, action, target string, meta gin.H) {
+	recordAudit(c, q, db.CreateAuditEventParams{
+		ActorUserID: actor,
+		Action:      action,
+		Target:      target,
+	}, meta)
+}
+
+// auditSubject records an event done to another user's account, which they
+// then see among their own events.
+func auditSubject(c *gin.Context, q *db.Queries, actor uuid.NullUUID, subject uuid.UUID, action, target string, meta gin.H) {
+	recordAudit(c, q, db.CreateAuditEventParams{
+		ActorUserID:   actor,
+		SubjectUserID: uuid.NullUUID{UUID: subject, Valid: subject != actor.UUID},
+		Action:        action,
+		Target:        target,
+	}, meta)
+}
+
+// auditInstance records an event about inst. Its owner sees it among their
+// own events whoever caused it.
+func auditInstance(c *gin.Context, q *db.Queries, actor uuid.NullUUID, inst db.Instances, action string, meta gin.H) {
+	recordAudit(c, q, db.CreateAuditEventParams{
+		ActorUserID:   actor,
+		SubjectUserID: uuid.NullUUID{UUID: inst.UserID, Valid: inst.UserID != actor.UUID},
+		InstanceID:    uuid.NullUUID{UUID: inst.ID, Valid: true},
+		Action:        action,
+		Target:        inst.ID.String(),
+	}, meta)
+}
+
+func recordAudit(c *gin.Context, q *db.Queries, ev db.CreateAuditEventParams, meta gin.H) {
+	if meta == nil {
+		meta = gin.H{}
+	}
+
+	raw, err := json.Marshal(meta)
+	if err != nil {
+		slog.ErrorContext(c, "encoding audit event failed", "action", ev.Action, "error", err)
+		return
+	}
+
+	ev.Ip = c.ClientIP()
+	ev.RequestID = c.GetString("requestID")
+	ev.Metadata = raw
+	if err := q.CreateAuditEvent(c, ev); err != nil {
+		slog.ErrorContext(c, "recording audit event failed", "action", ev.Action, "error", err)
+	}
+}
+
+// auditActor is the authenticated user, for audit records.
+func auditActor(c *gin.Context) uuid.NullUUID {
+	id, err := uuid.Parse(c.GetString("userID"))
+	return uuid.NullUUID{UUID: id, Valid: err == nil}
+}
+
+// exportBatch is how many events an export reads from the database at once.
+const exportBatch = 1000
+
+type AuditHandler struct {
+	q *db.Queries
+}
+
+func NewAuditHandler(q *db.Queries) *AuditHandler {
+	return &AuditHandler{q: q}
+}
+
+// ListMine lists events the caller caused or that concern them, newest
+// first.
+func (h *AuditHandler) ListMine(c *gin.Context) {
+	params, ok := h.filters(c, false)
+	if !ok {
+		return
+	}
+	h.list(c, params)
+}
+
+// ExportMine is ListMine as JSON lines, unpaginated.
+func (h *AuditHandler) ExportMine(c *gin.Context) {
+	params, ok := h.filters(c, false)
+	if !ok {
+		return
+	}
+	h.export(c, params)
+}
+
+// ListAll lists every event, newest first. ?user_id= narrows it to events
+// caused by or concerning a user, ?actor_id= to those a user caused.
+func (h *AuditHandler) ListAll(c *gin.Context) {
+	params, ok := h.filters(c, true)
+	if !ok {
+		return
+	}
+	h.list(c, params)
+}
+
+// ExportAll is ListAll as JSON lines, unpaginated. Exports are themselves
+// audited.
+func (h *AuditHandler) ExportAll(c *gin.Context) {
+	params, ok := h.filters(c, true)
+	if !ok {
+		return
+	}
+	audit(c, h.q, auditActor(c), auditLogExported, "", gin.H{"query": c.Request.URL.RawQuery})
+	h.export(c, params)
+}
+
+// filters reads the query string. Only admins may look past their own
+// events.
+func (h *AuditHandler) filters(c *gin.Context, admin bool) (db.ListAuditEventsParams, bool) {
+	var p db.ListAuditEventsParams
+	var ok bool
+
+	if admin {
+		if p.UserID, ok = queryUUID(c, "user_id"); !ok {
+			return p, false
+		}
+		if p.ActorUserID, ok = queryUUID(c, "actor_id"); !ok {
+			return p, false
+		}
+	} else {
+		p.UserID = auditActor(c)
+	}
+
+	if p.InstanceID, ok = queryUUID(c, "instance_id"); !ok {
+		return p, false
+	}
+	if p.Since, ok = queryTime(c, "since"); !ok {
+		return p, false
+	}
+	if p.Until, ok = queryTime(c, "until"); !ok {
+		return p, false
+	}
+	p.Action = queryString(c, "action")
+
+	return p, true
+}
+
+func (h *AuditHandler) list(c *gin.Context, p db.ListAuditEventsParams) {
+	p.Limit, p.Offset = pagination(c)
+
+	events, err := h.q.ListAuditEvents(c, p)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, events)
+}
+
+// export streams every matching event as one JSON object per line, paging
+// by ID so a long export neither holds one huge result nor rescans.
+func (h *AuditHandler) export(c *gin.Context, p db.ListAuditEventsParams) {
+	p.Limit = exportBatch
+
+	events, err := h.q.ListAuditEvents(c, p)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", `attachment; filename="audit-events-`+time.Now().UTC().Format("20060102T150405Z")+`.jsonl"`)
+	c.Status(http.StatusOK)
+
+	enc := json.NewEncoder(c.Writer)
+	for len(events) > 0 {
+		for _, e := range events {
+			if err := enc.Encode(e); err != nil {
+				return // the client went away
+			}
+		}
+		c.Writer.Flush()
+
+		if len(events) < exportBatch {
+			return
+		}
+		p.BeforeID = sql.NullInt64{Int64: events[len(events)-1].ID, Valid: true}
+		if events, err = h.q.ListAuditEvents(c, p); err != nil {
+			// too late for an error response; a short file is the signal
+			slog.ErrorContext(c, "exporting audit events failed", "error", err)
+			return
+		}
+	}
+}
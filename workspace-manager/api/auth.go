@@ -1,45 +1,115 @@
 package api
 
 import (
+	"database/sql"
+	"errors"
+	"log/slog"
+
 	db "example.com/m/v2/db/sqlc"
 
-	"example.com/m/v2/util"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func SignupHandler(q *db.Queries) gin.HandlerFunc {
+func SignupHandler(q *db.Queries, accounts *AccountHandler) gin.HandlerFunc {
   return func(c *gin.Context) {
-    var req struct{ Email, Password string }
-    if err := c.BindJSON(&req); err != nil { c.JSON(400, gin.H{"err":err.Error()}); return }
-    pwHash, _ := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
-user, err := q.CreateUser(c, db.CreateUserParams{
-    Email: req.Email,
-    Password: string(pwHash),
-})
-
-    if err != nil { c.JSON(500, gin.H{"err":err.Error()}); return }
+    var req struct {
+      Email, Password string
+      InviteCode string `json:"invite_code"`
+    }
+    if err := c.ShouldBindJSON(&req); err != nil { badRequest(c, err); return }
+    req.Email = normalizeEmail(req.Email)
+    if !validEmail(req.Email) { validationFailed(c, FieldError{Field: "email", Message: "invalid email address"}); return }
+    if weakPassword(c, req.Password, req.Email) { return }
+    pwHash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+    if err != nil { serverError(c, err); return }
+    user, err := accounts.createUser(c, req.Email, string(pwHash), req.InviteCode)
+    if errors.Is(err, errSignupClosed) {
+      audit(c, q, uuid.NullUUID{}, auditSignupRejected, req.Email, nil)
+      respondError(c, 403, err.Error())
+      return
+    }
+    if err != nil { serverError(c, err); return }
+    audit(c, q, uuid.NullUUID{UUID: user.ID, Valid: true}, auditSignedUp, user.Email, gin.H{"invite": req.InviteCode != ""})
+    // the account exists now; the user can ask for another link with
+    // /email/verify/resend
+    if err := accounts.SendVerification(c, user); err != nil {
+      slog.ErrorContext(c, "sending verification email failed", "user_id", user.ID, "error", err)
+    }
     c.JSON(200, gin.H{"id": user.ID})
   }
 }
 
+// dummyPasswordHash is compared against when there is no password to check,
+// so a login for an unknown email costs the same bcrypt work as a real one.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+
 func LoginHandler(q *db.Queries) gin.HandlerFunc {
   return func(c *gin.Context) {
-    var req struct{ Email, Password string }
-    if err := c.BindJSON(&req); err != nil { c.JSON(400, gin.H{"err":err.Error()}); return }
+    var req struct {
+      Email, Password string
+      OrgID string `json:"org_id"`
+    }
+    if err := c.ShouldBindJSON(&req); err != nil { badRequest(c, err); return }
+    req.Email = normalizeEmail(req.Email)
+
+    locked, err := loginLockout(c, q, c.ClientIP(), req.Email)
+    if err != nil { serverError(c, err); return }
+    if locked > 0 {
+      audit(c, q, uuid.NullUUID{}, auditLoginLocked, req.Email, nil)
+      respondLockedOut(c, locked)
+      return
+    }
+
     u, err := q.GetUserByEmail(c, req.Email)
-if err != nil {
-    c.JSON(401, gin.H{"err": "invalid"})
-    return
-}
+    if err != nil && !errors.Is(err, sql.ErrNoRows) { serverError(c, err); return }
+    found := err == nil
 
-if bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(req.Password)) != nil {
-    c.JSON(401, gin.H{"err": "invalid"})
-    return
-}
+    // unknown emails count as failures too, so probing for accounts is
+    // throttled, and take as long to check
+    hash := []byte(u.Password)
+    if !found || u.Password == "" { hash = dummyPasswordHash }
+    if bcrypt.CompareHashAndPassword(hash, []byte(req.Password)) != nil || !found || u.Password == "" {
+      if err := recordLoginFailure(c, q, c.ClientIP(), req.Email); err != nil { serverError(c, err); return }
+      audit(c, q, uuid.NullUUID{UUID: u.ID, Valid: found}, auditLoginFailed, req.Email, nil)
+      respondError(c, 401, "invalid")
+      return
+    }
+
+    if u.DisabledAt.Valid { respondError(c, 403, "account disabled"); return }
+
+    var orgID uuid.NullUUID
+    if req.OrgID != "" {
+      orgUUID, err := uuid.Parse(req.OrgID)
+      if err != nil { respondError(c, 400, "invalid org id"); return }
+      if _, err := q.GetOrgMember(c, db.GetOrgMemberParams{OrgID: orgUUID, UserID: u.ID}); err != nil {
+        respondError(c, 403, "not a member of this organization")
+        return
+      }
+      orgID = uuid.NullUUID{UUID: orgUUID, Valid: true}
+    }
+
+    mfa, err := mfaEnabled(c, q, u.ID)
+    if err != nil { serverError(c, err); return }
+
+    required, err := orgRequiresMFA(c, q, orgID)
+    if err != nil { serverError(c, err); return }
+    if required && !mfa { respondErrorCode(c, 403, codeMFARequired, "this organization requires multi-factor authentication; log in without it and enroll first", nil); return }
+
+    if mfa {
+      mfaToken, err := beginMFAChallenge(c, q, u.ID, orgID)
+      if err != nil { serverError(c, err); return }
+      c.JSON(200, gin.H{"mfa_required": true, "mfa_token": mfaToken})
+      return
+    }
+
+    // with MFA the failures are kept until the code is right too, so wrong
+    // codes keep counting towards the lockout
+    if err := clearAccountThrottle(c, q, req.Email); err != nil { serverError(c, err); return }
 
-    token, err := util.GenerateJWT(u.ID.String())
-    if err != nil { c.JSON(500, gin.H{"err":err.Error()}); return }
-    c.JSON(200, gin.H{"token": token})
+    tokens, err := startSession(c, q, u, orgID, false)
+    if err != nil { serverError(c, err); return }
+    c.JSON(200, tokens)
   }
 }
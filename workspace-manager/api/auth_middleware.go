@@ -2,20 +2,71 @@ package api
 
 import (
   "strings"
+  "log/slog"
   "net/http"
   "github.com/gin-gonic/gin"
+  "github.com/google/uuid"
+  db "example.com/m/v2/db/sqlc"
+  "example.com/m/v2/internal/logging"
   "example.com/m/v2/util"
 )
 
-func JWTMiddleware() gin.HandlerFunc {
+func JWTMiddleware(q *db.Queries) gin.HandlerFunc {
   return func(c *gin.Context) {
     auth := c.GetHeader("Authorization")
-    if auth=="" { c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"err":"no token"}); return }
+    if auth=="" { respondError(c, http.StatusUnauthorized, "no token"); return }
     parts := strings.SplitN(auth, " ", 2)
-    if len(parts)!=2 { c.AbortWithStatusJSON(http.StatusUnauthorized, nil); return }
-    userID, err := util.ParseJWT(parts[1])
-    if err!=nil { c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"err":err.Error()}); return }
-    c.Set("userID", userID)
+    if len(parts)!=2 { respondError(c, http.StatusUnauthorized, "malformed authorization header"); return }
+    if strings.HasPrefix(parts[1], apiTokenPrefix) { apiTokenAuth(c, q, parts[1]); return }
+    claims, err := util.ParseJWT(parts[1])
+    if err!=nil { respondError(c, http.StatusUnauthorized, err.Error()); return }
+    sess, reason := tokenUser(c, q, claims)
+    if reason!="" { respondError(c, http.StatusUnauthorized, reason); return }
+    c.Set("userID", claims.Subject)
+    c.Set("sessionID", claims.SessionID)
+    c.Set("orgID", claims.OrgID)
+    c.Set("role", claims.Role)
+    c.Set("mfaVerified", sess.MfaVerified)
+    logWith(c, slog.String(logging.UserIDKey, claims.Subject))
     c.Next()
   }
 }
+
+// bearerUserID is the non-aborting variant of JWTMiddleware for routes that
+// also accept other credentials.
+func bearerUserID(c *gin.Context, q *db.Queries) (uuid.UUID, bool) {
+  parts := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
+  if len(parts)!=2 { return uuid.Nil, false }
+  claims, err := util.ParseJWT(parts[1])
+  if err!=nil { return uuid.Nil, false }
+  sess, reason := tokenUser(c, q, claims)
+  if reason!="" { return uuid.Nil, false }
+  c.Set("mfaVerified", sess.MfaVerified)
+  return sess.UserID, true
+}
+
+// tokenUser checks an access token against the account as it is now, since
+// tokens outlive account changes: the user must not be disabled, must still
+// have the token's role, and the token's session must be active. It returns
+// the session, or why the token is refused.
+func tokenUser(c *gin.Context, q *db.Queries, claims *util.Claims) (db.Sessions, string) {
+  userUUID, err := uuid.Parse(claims.Subject)
+  if err!=nil { return db.Sessions{}, "invalid subject" }
+  u, err := q.GetUserByID(c, userUUID)
+  if err!=nil || u.DisabledAt.Valid { return db.Sessions{}, "account disabled" }
+  if u.Role != claims.Role { return db.Sessions{}, "role changed, log in again" }
+  sess, ok := activeSession(c, q, claims, userUUID)
+  if !ok { return db.Sessions{}, "session revoked" }
+  return sess, ""
+}
+
+// activeSession loads the token's session, reporting whether it still
+// exists, belongs to the token's user and has not been revoked by logout or
+// refresh token reuse.
+func activeSession(c *gin.Context, q *db.Queries, claims *util.Claims, userID uuid.UUID) (db.Sessions, bool) {
+  sessionID, err := uuid.Parse(claims.SessionID)
+  if err!=nil { return db.Sessions{}, false }
+  sess, err := q.GetSession(c, sessionID)
+  if err!=nil { return db.Sessions{}, false }
+  return sess, sess.UserID==userID && !sess.RevokedAt.Valid
+}
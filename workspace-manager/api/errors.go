@@ -0,0 +1,133 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Error codes clients can switch on. Messages are meant for people and may
+// change; codes do not.
+const (
+	codeInvalidRequest   = "invalid_request"
+	codeValidationFailed = "validation_failed"
+	codeUnauthorized     = "unauthorized"
+	codeForbidden        = "forbidden"
+	codeNotFound         = "not_found"
+	codeConflict         = "conflict"
+	codeRateLimited      = "rate_limited"
+	codeInternal         = "internal"
+	codeUpstream         = "upstream_unavailable"
+
+	codeEmailTaken   = "email_taken"
+	codeWeakPassword = "weak_password"
+	codeMFARequired  = "mfa_required"
+)
+
+// APIError is the body of every error response, wrapped as {"error": ...}.
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details any    `json:"details,omitempty"`
+}
+
+// FieldError is the details entry for a rejected request field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func statusCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return codeInvalidRequest
+	case http.StatusUnauthorized:
+		return codeUnauthorized
+	case http.StatusForbidden:
+		return codeForbidden
+	case http.StatusNotFound:
+		return codeNotFound
+	case http.StatusConflict:
+		return codeConflict
+	case http.StatusTooManyRequests:
+		return codeRateLimited
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codeUpstream
+	}
+	return codeInternal
+}
+
+// respondError ends the request with an error whose code follows from the
+// status. It aborts, so it serves middleware and handlers alike.
+func respondError(c *gin.Context, status int, message string) {
+	respondErrorCode(c, status, statusCode(status), message, nil)
+}
+
+func respondErrorCode(c *gin.Context, status int, code, message string, details any) {
+	c.AbortWithStatusJSON(status, gin.H{"error": APIError{
+		Code:    code,
+		Message: message,
+		Details: details,
+	}})
+}
+
+// badRequest reports a body that could not be decoded.
+func badRequest(c *gin.Context, err error) {
+	respondErrorCode(c, http.StatusBadRequest, codeInvalidRequest, "invalid request body", err.Error())
+}
+
+// validationFailed reports request fields that decoded but were rejected.
+func validationFailed(c *gin.Context, fields ...FieldError) {
+	respondErrorCode(c, http.StatusBadRequest, codeValidationFailed, fields[0].Message, fields)
+}
+
+// uniqueViolations names the conflicts clients are expected to handle, by
+// constraint.
+var uniqueViolations = map[string]APIError{
+	"users_email_key":       {Code: codeEmailTaken, Message: "an account with this email already exists"},
+	"idx_users_email_lower": {Code: codeEmailTaken, Message: "an account with this email already exists"},
+
+	"idx_data_exports_active": {Code: codeConflict, Message: "an export is already in progress"},
+	"instance_members_pkey":   {Code: codeConflict, Message: "already a member; change their role instead"},
+	"org_members_pkey":        {Code: codeConflict, Message: "already a member; change their role instead"},
+}
+
+// serverError maps an unexpected error to a response. Constraint violations
+// become 4xx responses; anything else is logged and hidden from the client
+// as a 500.
+func serverError(c *gin.Context, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(c, http.StatusNotFound, "not found")
+		return
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23505": // unique_violation
+			if e, ok := uniqueViolations[pgErr.ConstraintName]; ok {
+				respondErrorCode(c, http.StatusConflict, e.Code, e.Message, nil)
+				return
+			}
+			respondError(c, http.StatusConflict, "already exists")
+			return
+		case "23503": // foreign_key_violation
+			respondError(c, http.StatusConflict, "refers to a record that does not exist or is still in use")
+			return
+		case "23514", "22P02": // check_violation, invalid_text_representation
+			respondError(c, http.StatusBadRequest, "invalid value")
+			return
+		}
+	}
+
+	slog.ErrorContext(c.Request.Context(), "request failed",
+		"method", c.Request.Method,
+		"route", c.FullPath(),
+		"error", err,
+	)
+	respondError(c, http.StatusInternalServerError, "internal server error")
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	db "example.com/m/v2/db/sqlc"
+	"example.com/m/v2/internal/worker"
+	"example.com/m/v2/util"
+)
+
+type exportResponse struct {
+	ID          uuid.UUID  `json:"id"`
+	Status      string     `json:"status"`
+	IncludeData bool       `json:"include_data"`
+	Error       string     `json:"error,omitempty"`
+	SizeBytes   *int64     `json:"size_bytes"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+
+	// short-lived; fetch the export again for a fresh one
+	DownloadURL string `json:"download_url,omitempty"`
+}
+
+func newExportResponse(exp db.DataExports) (exportResponse, error) {
+	resp := exportResponse{
+		ID:          exp.ID,
+		Status:      exp.Status,
+		IncludeData: exp.IncludeData,
+		Error:       exp.Error,
+		CreatedAt:   exp.CreatedAt,
+	}
+	if exp.SizeBytes.Valid {
+		resp.SizeBytes = &exp.SizeBytes.Int64
+	}
+	if exp.CompletedAt.Valid {
+		resp.CompletedAt = &exp.CompletedAt.Time
+	}
+	if exp.ExpiresAt.Valid {
+		resp.ExpiresAt = &exp.ExpiresAt.Time
+	}
+
+	if exportAvailable(exp) {
+		token, err := util.SignDownload(exp.ID.String())
+		if err != nil {
+			return exportResponse{}, err
+		}
+		resp.DownloadURL = "/exports/" + exp.ID.String() + "/download?token=" + token
+	}
+
+	return resp, nil
+}
+
+func exportAvailable(exp db.DataExports) bool {
+	return exp.Status == "ready" && exp.ExpiresAt.Valid && time.Now().Before(exp.ExpiresAt.Time)
+}
+
+// RequestExport queues an archive of the caller's account, instances and
+// audit trail, optionally with their workspace data. Poll GetExport for the
+// download link.
+func (h *MeHandler) RequestExport(c *gin.Context) {
+	var req struct {
+		IncludeData bool `json:"include_data"`
+	}
+
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			badRequest(c, err)
+			return
+		}
+	}
+
+	userID, ok := callerID(c)
+	if !ok {
+		return
+	}
+
+	exp, err := h.q.CreateDataExport(c, db.CreateDataExportParams{
+		UserID:      userID,
+		IncludeData: req.IncludeData,
+	})
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	audit(c, h.q, uuid.NullUUID{UUID: userID, Valid: true}, auditExportRequested, exp.ID.String(), gin.H{
+		"include_data": exp.IncludeData,
+	})
+
+	resp, err := newExportResponse(exp)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	c.JSON(202, resp)
+}
+
+func (h *MeHandler) ListExports(c *gin.Context) {
+	userID, ok := callerID(c)
+	if !ok {
+		return
+	}
+
+	exports, err := h.q.ListUserDataExports(c, userID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	resp := make([]exportResponse, 0, len(exports))
+	for _, exp := range exports {
+		r, err := newExportResponse(exp)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+		resp = append(resp, r)
+	}
+
+	c.JSON(200, resp)
+}
+
+func (h *MeHandler) GetExport(c *gin.Context) {
+	userID, ok := callerID(c)
+	if !ok {
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respondError(c, 400, "invalid export id")
+		return
+	}
+
+	exp, err := h.q.GetDataExport(c, id)
+	if err != nil || exp.UserID != userID {
+		respondError(c, 404, "export not found")
+		return
+	}
+
+	resp, err := newExportResponse(exp)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	c.JSON(200, resp)
+}
+
+// DownloadExport serves a finished archive. The signed token in the link is
+// the only credential, so it works from a plain browser download.
+func (h *MeHandler) DownloadExport(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil || !util.VerifyDownload(c.Query("token"), id.String()) {
+		respondError(c, 403, "invalid or expired download link")
+		return
+	}
+
+	exp, err := h.q.GetDataExport(c, id)
+	if err != nil || !exportAvailable(exp) {
+		respondError(c, 404, "export not available")
+		return
+	}
+
+	audit(c, h.q, uuid.NullUUID{UUID: exp.UserID, Valid: true}, auditExportDownloaded, exp.ID.String(), nil)
+
+	c.Header("Cache-Control", "no-store")
+	c.FileAttachment(
+		worker.ExportPath(h.exportDir, exp.UserID, exp.ID),
+		"ambilio-export-"+exp.CreatedAt.Format("2006-01-02")+".zip",
+	)
+}
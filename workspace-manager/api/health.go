@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	ecsmanager "example.com/m/v2/ecs"
+	"example.com/m/v2/internal/docker"
+	"example.com/m/v2/internal/worker"
+)
+
+// checkTimeout bounds each readiness check, so one hung dependency cannot
+// stall the probe past the orchestrator's own timeout.
+const checkTimeout = 2 * time.Second
+
+type checkResult struct {
+	Status    string `json:"status"` // ok | failing
+	Error     string `json:"error,omitempty"`
+	LatencyMS int64  `json:"latency_ms"`
+}
+
+// Health serves the liveness and readiness probes, and the background
+// workers' status.
+type Health struct {
+	conn    *sql.DB
+	docker  *docker.DockerManager
+	ecs     *ecsmanager.ECSManager // nil unless workspaces run on ECS
+	workers []*worker.Heartbeat
+
+	draining atomic.Bool
+}
+
+func NewHealth(conn *sql.DB, ecs *ecsmanager.ECSManager, workers ...*worker.Heartbeat) *Health {
+	return &Health{
+		conn:    conn,
+		docker:  docker.NewDockerManager(),
+		ecs:     ecs,
+		workers: workers,
+	}
+}
+
+// Drain makes readiness fail from now on, so load balancers stop sending
+// traffic while in-flight requests finish.
+func (h *Health) Drain() {
+	h.draining.Store(true)
+}
+
+// Live answers as long as the process can serve HTTP at all.
+func (h *Health) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Ready checks every dependency and reports each one, answering 503 if any
+// of them fails.
+func (h *Health) Ready(c *gin.Context) {
+	checks := map[string]func(context.Context) error{
+		"postgres": h.conn.PingContext,
+		"docker":   h.docker.Ping,
+	}
+	if h.ecs != nil {
+		checks["ecs"] = h.ecs.Ping
+	}
+
+	results, ok := runChecks(c.Request.Context(), checks)
+
+	status, code := "ok", http.StatusOK
+	if !ok {
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+	if h.draining.Load() {
+		status, code = "draining", http.StatusServiceUnavailable
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(code, gin.H{
+		"status": status,
+		"checks": results,
+	})
+}
+
+// Workers reports whether each background worker is still coming round,
+// answering 503 if any has stalled. It is for monitoring only: a stalled
+// worker does not stop the replica serving requests, so readiness leaves
+// workers out.
+func (h *Health) Workers(c *gin.Context) {
+	checks := make(map[string]func(context.Context) error, len(h.workers))
+	for _, hb := range h.workers {
+		checks[hb.Name] = func(context.Context) error { return hb.Check() }
+	}
+
+	results, ok := runChecks(c.Request.Context(), checks)
+
+	status, code := "ok", http.StatusOK
+	if !ok {
+		status, code = "degraded", http.StatusServiceUnavailable
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(code, gin.H{
+		"status":  status,
+		"workers": results,
+	})
+}
+
+// runChecks runs the checks concurrently, each bounded by checkTimeout, and
+// reports whether all of them passed.
+func runChecks(ctx context.Context, checks map[string]func(context.Context) error) (map[string]checkResult, bool) {
+	results := make(map[string]checkResult, len(checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check(ctx)
+
+			r := checkResult{Status: "ok", LatencyMS: time.Since(start).Milliseconds()}
+			if err != nil {
+				r.Status = "failing"
+				r.Error = err.Error()
+			}
+
+			mu.Lock()
+			results[name] = r
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	for _, r := range results {
+		if r.Status != "ok" {
+			return results, false
+		}
+	}
+	return results, true
+}
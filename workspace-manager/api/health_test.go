@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	db "example.com/m/v2/db/sqlc"
+	"example.com/m/v2/internal/worker"
+)
+
+// stoppedWorker returns the heartbeat of a worker that has already exited.
+func stoppedWorker(t *testing.T) *worker.Heartbeat {
+	t.Helper()
+
+	w := worker.NewExpiryWarningWorker(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var wg sync.WaitGroup
+	w.Start(ctx, &wg)
+	wg.Wait()
+	return w.Heartbeat()
+}
+
+func TestReadyIgnoresWorkers(t *testing.T) {
+	// nothing listens on port 1, so postgres fails fast
+	conn, err := sql.Open("pgx", "postgres://127.0.0.1:1/none?connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	h := NewHealth(conn, nil, stoppedWorker(t))
+
+	w := serve(t, "GET", "/readyz", "/readyz", nil, db.Sessions{}, h.Ready)
+
+	var body struct {
+		Checks map[string]checkResult `json:"checks"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	for name := range body.Checks {
+		if strings.HasPrefix(name, "worker:") {
+			t.Errorf("readiness checks %s", name)
+		}
+	}
+	if _, ok := body.Checks["postgres"]; !ok {
+		t.Errorf("checks = %v, want postgres among them", body.Checks)
+	}
+}
+
+func TestWorkers(t *testing.T) {
+	running := worker.NewExpiryWarningWorker(nil).Heartbeat()
+
+	tests := []struct {
+		name    string
+		workers []*worker.Heartbeat
+		status  int
+	}{
+		{"none", nil, 200},
+		{"running", []*worker.Heartbeat{running}, 200},
+		{"stopped", []*worker.Heartbeat{stoppedWorker(t)}, 503},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Health{workers: tt.workers}
+			w := serve(t, "GET", "/workerz", "/workerz", nil, db.Sessions{}, h.Workers)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+
+			var body struct {
+				Workers map[string]checkResult `json:"workers"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if len(body.Workers) != len(tt.workers) {
+				t.Errorf("workers = %v, want %d of them", body.Workers, len(tt.workers))
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	db "example.com/m/v2/db/sqlc"
+	"example.com/m/v2/internal/events"
+	"example.com/m/v2/util"
+)
+
+// sseKeepalive is how often an idle stream sends a comment, so proxies and
+// load balancers do not close it.
+const sseKeepalive = 25 * time.Second
+
+// streamAccessTTL is how long a stream trusts its answers to whether the
+// caller is still signed in and may see an instance, so someone logged out,
+// disabled or removed from an instance or its organization stops getting
+// events shortly after.
+const streamAccessTTL = 30 * time.Second
+
+type streamAccess struct {
+	allowed   bool
+	checkedAt time.Time
+}
+
+// Events streams the caller's instance events as server-sent events: status
+// changes, start progress and expiry warnings, each named after its type
+// with the event as JSON data. It needs the Authorization header like any
+// other route, so browsers use a fetch-based EventSource.
+//
+// The stream opens with a snapshot event listing the status of every
+// instance the caller is a member of, taken after subscribing, so nothing
+// falls between the two. Events follow for any instance the caller has a
+// role on, including those of organizations they administer. The server
+// ends the stream when it shuts down, when the client falls behind or
+// events may have been lost, and when the credential it was opened with
+// expires or is revoked or the account is disabled; the client should then
+// reconnect and start again from the new snapshot.
+func (h *InstanceHandler) Events(c *gin.Context) {
+	userUUID, ok := callerID(c)
+	if !ok {
+		return
+	}
+
+	sub, unsubscribe := h.broker.Subscribe()
+	defer unsubscribe()
+
+	instances, err := h.memberInstances(c, userUUID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	access := make(map[uuid.UUID]streamAccess, len(instances))
+	snapshot := make([]gin.H, 0, len(instances))
+	for _, inst := range instances {
+		access[inst.ID] = streamAccess{allowed: true, checkedAt: time.Now()}
+		snapshot = append(snapshot, gin.H{
+			"instance_id": inst.ID,
+			"status":      inst.Status,
+		})
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no") // nginx would otherwise buffer the stream
+	c.Status(200)
+
+	c.SSEvent("snapshot", snapshot)
+	c.Writer.Flush()
+
+	keepalive := time.NewTicker(sseKeepalive)
+	defer keepalive.Stop()
+
+	recheck := time.NewTicker(streamAccessTTL)
+	defer recheck.Stop()
+
+	for {
+		select {
+		case ev, ok := <-sub:
+			if !ok {
+				return
+			}
+
+			deleted := ev.Type == events.TypeStatus && ev.Status == "deleted"
+			a, known := access[ev.InstanceID]
+			// a deleted instance can no longer be looked up; it was either
+			// seen before or is not the caller's
+			if !deleted && (!known || time.Since(a.checkedAt) > streamAccessTTL) {
+				a = streamAccess{allowed: h.streamAllowed(c, ev, userUUID), checkedAt: time.Now()}
+				access[ev.InstanceID] = a
+			}
+			if deleted {
+				delete(access, ev.InstanceID)
+			}
+			if !a.allowed {
+				continue
+			}
+
+			c.SSEvent(ev.Type, ev)
+			c.Writer.Flush()
+
+		case <-recheck.C:
+			if !stillAuthenticated(c, h.q) {
+				return
+			}
+
+		case <-keepalive.C:
+			if _, err := io.WriteString(c.Writer, ": keepalive\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// stillAuthenticated re-checks the credential a stream was opened with, as
+// JWTMiddleware did: access tokens must not have expired, and their session
+// must still be active; API tokens must not have expired or been revoked;
+// and the account must not be disabled. Failed lookups count as no.
+func stillAuthenticated(c *gin.Context, q *db.Queries) bool {
+	parts := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
+	if len(parts) != 2 {
+		return false
+	}
+
+	if strings.HasPrefix(parts[1], apiTokenPrefix) {
+		t, err := q.GetAPITokenByHash(c, util.HashToken(parts[1]))
+		if err != nil || t.RevokedAt.Valid || time.Now().After(t.ExpiresAt) {
+			return false
+		}
+		u, err := q.GetUserByID(c, t.UserID)
+		return err == nil && !u.DisabledAt.Valid
+	}
+
+	claims, err := util.ParseJWT(parts[1])
+	if err != nil {
+		return false
+	}
+	_, reason := tokenUser(c, q, claims)
+	return reason == ""
+}
+
+// streamAllowed reports whether the caller has any role on the event's
+// instance now. Failed lookups count as no, and are retried after
+// streamAccessTTL.
+func (h *InstanceHandler) streamAllowed(c *gin.Context, ev events.Event, userUUID uuid.UUID) bool {
+	inst := db.Instances{ID: ev.InstanceID, UserID: ev.UserID}
+	if ev.OrgID != nil {
+		inst.OrgID = uuid.NullUUID{UUID: *ev.OrgID, Valid: true}
+	}
+
+	_, err := instanceRole(c, h.q, inst, userUUID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) && !errors.Is(err, errMFARequired) {
+		slog.WarnContext(c, "checking event stream access failed", "instance_id", ev.InstanceID, "error", err)
+	}
+	return err == nil
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	db "example.com/m/v2/db/sqlc"
+	"example.com/m/v2/util"
+)
+
+func TestStillAuthenticated(t *testing.T) {
+	_, q := testDB(t)
+	ctx := context.Background()
+
+	check := func(authorization string) bool {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/instances/events", nil)
+		if authorization != "" {
+			c.Request.Header.Set("Authorization", authorization)
+		}
+		return stillAuthenticated(c, q)
+	}
+	accessToken := func(u db.Users) (string, db.Sessions) {
+		sess := testSession(t, q, u, false)
+		jwt, err := util.GenerateJWT(u.ID.String(), sess.ID.String(), "", u.Role)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + jwt, sess
+	}
+	apiToken := func(u db.Users, expiresAt time.Time) (string, db.ApiTokens) {
+		secret, _, err := util.NewToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		token := apiTokenPrefix + secret
+		row, err := q.CreateAPIToken(ctx, db.CreateAPITokenParams{
+			UserID:    u.ID,
+			Name:      "test",
+			TokenHash: util.HashToken(token),
+			Prefix:    token[:12],
+			ExpiresAt: expiresAt,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + token, row
+	}
+
+	t.Run("no credential", func(t *testing.T) {
+		if check("") {
+			t.Error("accepted")
+		}
+	})
+
+	t.Run("session", func(t *testing.T) {
+		u := testUser(t, q)
+		auth, sess := accessToken(u)
+		if !check(auth) {
+			t.Fatal("active session refused")
+		}
+		if err := q.RevokeSession(ctx, sess.ID); err != nil {
+			t.Fatal(err)
+		}
+		if check(auth) {
+			t.Error("revoked session accepted")
+		}
+	})
+
+	t.Run("api token", func(t *testing.T) {
+		u := testUser(t, q)
+		auth, row := apiToken(u, time.Now().Add(time.Hour))
+		if !check(auth) {
+			t.Fatal("active token refused")
+		}
+		if _, err := q.RevokeAPIToken(ctx, db.RevokeAPITokenParams{ID: row.ID, UserID: u.ID}); err != nil {
+			t.Fatal(err)
+		}
+		if check(auth) {
+			t.Error("revoked token accepted")
+		}
+	})
+
+	t.Run("expired api token", func(t *testing.T) {
+		auth, _ := apiToken(testUser(t, q), time.Now().Add(-time.Minute))
+		if check(auth) {
+			t.Error("expired token accepted")
+		}
+	})
+
+	t.Run("disabled account", func(t *testing.T) {
+		u := testUser(t, q)
+		session, _ := accessToken(u)
+		token, _ := apiToken(u, time.Now().Add(time.Hour))
+		if _, err := q.SetUserDisabled(ctx, db.SetUserDisabledParams{ID: u.ID, Disabled: true}); err != nil {
+			t.Fatal(err)
+		}
+		if check(session) {
+			t.Error("access token of a disabled account accepted")
+		}
+		if check(token) {
+			t.Error("api token of a disabled account accepted")
+		}
+	})
+}
@@ -0,0 +1,307 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	db "example.com/m/v2/db/sqlc"
+)
+
+const (
+	memberRoleOwner  = "owner"
+	memberRoleEditor = "editor"
+	memberRoleViewer = "viewer"
+)
+
+var memberRoleRank = map[string]int{
+	memberRoleViewer: 1,
+	memberRoleEditor: 2,
+	memberRoleOwner:  3,
+}
+
+func validMemberRole(role string) bool {
+	_, ok := memberRoleRank[role]
+	return ok
+}
+
+// instanceRole resolves the caller's effective role on an instance: their own
+// membership, or owner when they administer the organization owning it. It
+// returns errMFARequired for an organization's instance when the
+// organization requires MFA and the caller's credential did not pass it.
+func instanceRole(c *gin.Context, q *db.Queries, inst db.Instances, userID uuid.UUID) (string, error) {
+	role, err := memberRole(c, q, inst, userID)
+	if err != nil {
+		return "", err
+	}
+	if inst.OrgID.Valid {
+		if err := checkOrgMFA(c, q, inst.OrgID.UUID); err != nil {
+			return "", err
+		}
+	}
+	return role, nil
+}
+
+func memberRole(ctx context.Context, q *db.Queries, inst db.Instances, userID uuid.UUID) (string, error) {
+	member, err := q.GetInstanceMember(ctx, db.GetInstanceMemberParams{
+		InstanceID: inst.ID,
+		UserID:     userID,
+	})
+	if err == nil {
+		return member.Role, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) || !inst.OrgID.Valid {
+		return "", err
+	}
+
+	orgMember, err := q.GetOrgMember(ctx, db.GetOrgMemberParams{
+		OrgID:  inst.OrgID.UUID,
+		UserID: userID,
+	})
+	if err != nil {
+		return "", err
+	}
+	if orgMember.Role != orgRoleAdmin {
+		return "", sql.ErrNoRows
+	}
+
+	return memberRoleOwner, nil
+}
+
+// authorizeInstance loads the instance named by the :id param and checks that
+// the caller has at least minRole on it. It writes the error response itself;
+// callers without any role get a 404 so instance IDs are not confirmed to them.
+func (h *InstanceHandler) authorizeInstance(c *gin.Context, minRole string) (db.Instances, uuid.UUID, bool) {
+	userUUID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		respondError(c, 401, "unauthorized")
+		return db.Instances{}, uuid.Nil, false
+	}
+
+	instanceID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respondError(c, 400, "invalid instance id")
+		return db.Instances{}, uuid.Nil, false
+	}
+
+	inst, err := h.q.GetInstanceByID(c, instanceID)
+	if err != nil {
+		respondError(c, 404, "instance not found")
+		return db.Instances{}, uuid.Nil, false
+	}
+
+	role, err := instanceRole(c, h.q, inst, userUUID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(c, 404, "instance not found")
+		return db.Instances{}, uuid.Nil, false
+	}
+	if errors.Is(err, errMFARequired) {
+		respondMFARequired(c)
+		return db.Instances{}, uuid.Nil, false
+	}
+	if err != nil {
+		serverError(c, err)
+		return db.Instances{}, uuid.Nil, false
+	}
+
+	if memberRoleRank[role] < memberRoleRank[minRole] {
+		respondError(c, 403, "requires "+minRole+" role")
+		return db.Instances{}, uuid.Nil, false
+	}
+
+	return inst, userUUID, true
+}
+
+func (h *InstanceHandler) ListMembers(c *gin.Context) {
+	inst, _, ok := h.authorizeInstance(c, memberRoleViewer)
+	if !ok {
+		return
+	}
+
+	members, err := h.q.ListInstanceMembers(c, inst.ID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	c.JSON(200, members)
+}
+
+func (h *InstanceHandler) InviteMember(c *gin.Context) {
+	var req struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = memberRoleViewer
+	}
+	if !validMemberRole(req.Role) {
+		respondError(c, 400, "role must be owner, editor or viewer")
+		return
+	}
+
+	inst, callerID, ok := h.authorizeInstance(c, memberRoleOwner)
+	if !ok {
+		return
+	}
+
+	invitee, err := h.q.GetUserByEmail(c, normalizeEmail(req.Email))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(c, 404, "no user with that email")
+		return
+	}
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	if invitee.ID == callerID {
+		respondError(c, 400, "cannot change your own membership by invite")
+		return
+	}
+
+	member, err := h.q.AddInstanceMember(c, db.AddInstanceMemberParams{
+		InstanceID: inst.ID,
+		UserID:     invitee.ID,
+		Role:       req.Role,
+		InvitedBy:  uuid.NullUUID{UUID: callerID, Valid: true},
+	})
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	auditInstance(c, h.q, uuid.NullUUID{UUID: callerID, Valid: true}, inst, auditMemberAdded, gin.H{
+		"member_id": invitee.ID,
+		"role":      req.Role,
+	})
+
+	c.JSON(201, member)
+}
+
+func (h *InstanceHandler) UpdateMember(c *gin.Context) {
+	var req struct {
+		Role string `json:"role"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if !validMemberRole(req.Role) {
+		respondError(c, 400, "role must be owner, editor or viewer")
+		return
+	}
+
+	memberID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		respondError(c, 400, "invalid user id")
+		return
+	}
+
+	inst, callerID, ok := h.authorizeInstance(c, memberRoleOwner)
+	if !ok {
+		return
+	}
+
+	current, err := h.q.GetInstanceMember(c, db.GetInstanceMemberParams{
+		InstanceID: inst.ID,
+		UserID:     memberID,
+	})
+	if err != nil {
+		respondError(c, 404, "member not found")
+		return
+	}
+
+	if current.Role == memberRoleOwner && req.Role != memberRoleOwner {
+		if !h.hasOtherOwner(c, inst.ID) {
+			return
+		}
+	}
+
+	member, err := h.q.UpdateInstanceMemberRole(c, db.UpdateInstanceMemberRoleParams{
+		InstanceID: inst.ID,
+		UserID:     memberID,
+		Role:       req.Role,
+	})
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	auditInstance(c, h.q, uuid.NullUUID{UUID: callerID, Valid: true}, inst, auditMemberUpdated, gin.H{
+		"member_id": memberID,
+		"from_role": current.Role,
+		"role":      req.Role,
+	})
+
+	c.JSON(200, member)
+}
+
+// RemoveMember lets owners remove anyone and any member remove themselves.
+func (h *InstanceHandler) RemoveMember(c *gin.Context) {
+	memberID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		respondError(c, 400, "invalid user id")
+		return
+	}
+
+	minRole := memberRoleOwner
+	if memberID.String() == c.GetString("userID") {
+		minRole = memberRoleViewer
+	}
+
+	inst, callerID, ok := h.authorizeInstance(c, minRole)
+	if !ok {
+		return
+	}
+
+	current, err := h.q.GetInstanceMember(c, db.GetInstanceMemberParams{
+		InstanceID: inst.ID,
+		UserID:     memberID,
+	})
+	if err != nil {
+		respondError(c, 404, "member not found")
+		return
+	}
+
+	if current.Role == memberRoleOwner && !h.hasOtherOwner(c, inst.ID) {
+		return
+	}
+
+	if _, err := h.q.RemoveInstanceMember(c, db.RemoveInstanceMemberParams{
+		InstanceID: inst.ID,
+		UserID:     memberID,
+	}); err != nil {
+		serverError(c, err)
+		return
+	}
+	auditInstance(c, h.q, uuid.NullUUID{UUID: callerID, Valid: true}, inst, auditMemberRemoved, gin.H{
+		"member_id": memberID,
+		"role":      current.Role,
+	})
+
+	c.JSON(200, gin.H{"ok": true})
+}
+
+// hasOtherOwner guards against leaving an instance without an owner.
+func (h *InstanceHandler) hasOtherOwner(c *gin.Context, instanceID uuid.UUID) bool {
+	owners, err := h.q.CountInstanceOwners(c, instanceID)
+	if err != nil {
+		serverError(c, err)
+		return false
+	}
+	if owners < 2 {
+		respondError(c, 409, "instance must keep at least one owner")
+		return false
+	}
+	return true
+}
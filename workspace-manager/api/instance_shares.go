@@ -0,0 +1,189 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	db "example.com/m/v2/db/sqlc"
+	"example.com/m/v2/util"
+)
+
+const (
+	shareRoleView = "view"
+	shareRoleFull = "full"
+
+	defaultShareTTLHours = 24
+	maxShareTTLHours     = 24 * 30
+)
+
+type shareResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	InstanceID uuid.UUID  `json:"instance_id"`
+	CreatedBy  uuid.UUID  `json:"created_by"`
+	Role       string     `json:"role"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func newShareResponse(s db.InstanceShares) shareResponse {
+	resp := shareResponse{
+		ID:         s.ID,
+		InstanceID: s.InstanceID,
+		CreatedBy:  s.CreatedBy,
+		Role:       s.Role,
+		ExpiresAt:  s.ExpiresAt,
+		CreatedAt:  s.CreatedAt,
+	}
+	if s.RevokedAt.Valid {
+		resp.RevokedAt = &s.RevokedAt.Time
+	}
+	return resp
+}
+
+func (h *InstanceHandler) CreateShare(c *gin.Context) {
+	var req struct {
+		Role           string `json:"role"`
+		ExpiresInHours int32  `json:"expires_in_hours"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = shareRoleView
+	}
+	if req.Role != shareRoleView && req.Role != shareRoleFull {
+		respondError(c, 400, "role must be view or full")
+		return
+	}
+
+	if req.ExpiresInHours == 0 {
+		req.ExpiresInHours = defaultShareTTLHours
+	}
+	if req.ExpiresInHours < 0 || req.ExpiresInHours > maxShareTTLHours {
+		respondError(c, 400, "expires_in_hours must be between 1 and 720")
+		return
+	}
+
+	inst, callerID, ok := h.authorizeInstance(c, memberRoleOwner)
+	if !ok {
+		return
+	}
+
+	token, hash, err := util.NewToken()
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	share, err := h.q.CreateInstanceShare(c, db.CreateInstanceShareParams{
+		InstanceID: inst.ID,
+		CreatedBy:  callerID,
+		TokenHash:  hash,
+		Role:       req.Role,
+		ExpiresAt:  time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour),
+	})
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	auditInstance(c, h.q, uuid.NullUUID{UUID: callerID, Valid: true}, inst, auditShareCreated, gin.H{
+		"share_id":   share.ID,
+		"role":       share.Role,
+		"expires_at": share.ExpiresAt,
+	})
+
+	c.JSON(201, gin.H{
+		"share": newShareResponse(share),
+		"token": token,
+		"url":   "/workspaces/" + inst.ID.String() + "/?" + shareQueryParam + "=" + token,
+	})
+}
+
+func (h *InstanceHandler) ListShares(c *gin.Context) {
+	inst, _, ok := h.authorizeInstance(c, memberRoleOwner)
+	if !ok {
+		return
+	}
+
+	shares, err := h.q.ListInstanceShares(c, inst.ID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	resp := make([]shareResponse, 0, len(shares))
+	for _, s := range shares {
+		resp = append(resp, newShareResponse(s))
+	}
+
+	c.JSON(200, resp)
+}
+
+func (h *InstanceHandler) RevokeShare(c *gin.Context) {
+	shareID, err := uuid.Parse(c.Param("shareId"))
+	if err != nil {
+		respondError(c, 400, "invalid share id")
+		return
+	}
+
+	inst, callerID, ok := h.authorizeInstance(c, memberRoleOwner)
+	if !ok {
+		return
+	}
+
+	share, err := h.q.RevokeInstanceShare(c, db.RevokeInstanceShareParams{
+		ID:         shareID,
+		InstanceID: inst.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(c, 404, "share not found or already revoked")
+		return
+	}
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	auditInstance(c, h.q, uuid.NullUUID{UUID: callerID, Valid: true}, inst, auditShareRevoked, gin.H{
+		"share_id": share.ID,
+	})
+
+	c.JSON(200, newShareResponse(share))
+}
+
+func (h *InstanceHandler) ListShareAccesses(c *gin.Context) {
+	shareID, err := uuid.Parse(c.Param("shareId"))
+	if err != nil {
+		respondError(c, 400, "invalid share id")
+		return
+	}
+
+	inst, _, ok := h.authorizeInstance(c, memberRoleOwner)
+	if !ok {
+		return
+	}
+
+	share, err := h.q.GetInstanceShare(c, db.GetInstanceShareParams{
+		ID:         shareID,
+		InstanceID: inst.ID,
+	})
+	if err != nil {
+		respondError(c, 404, "share not found")
+		return
+	}
+
+	accesses, err := h.q.ListShareAccesses(c, share.ID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	c.JSON(200, accesses)
+}
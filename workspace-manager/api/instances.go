@@ -2,6 +2,8 @@ package api
 
 import (
 	"database/sql"
+	"errors"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -12,18 +14,84 @@ import (
 
 	db "example.com/m/v2/db/sqlc"
 	"example.com/m/v2/internal/docker"
+	"example.com/m/v2/internal/events"
+	"example.com/m/v2/internal/webhook"
 )
 
+// dataRoot holds one directory per user and instance, mounted into containers.
+const dataRoot = "/var/lib/ambilio"
+
+// instanceTypes are the workspace types that can be created.
+var instanceTypes = map[string]bool{
+	"vscode":   true,
+	"jupyter":  true,
+	"mysql":    true,
+	"langflow": true,
+	"weaviate": true,
+	"aws":      true,
+}
+
 type InstanceHandler struct {
-	q      *db.Queries
-	docker *docker.DockerManager
+	conn      *sql.DB
+	q         *db.Queries
+	docker    *docker.DockerManager
+	sandboxes *docker.AWSService
+	broker    *events.Broker
 }
 
-func NewInstanceHandler(q *db.Queries) *InstanceHandler {
+func NewInstanceHandler(conn *sql.DB, q *db.Queries, sandboxes *docker.AWSService, broker *events.Broker) *InstanceHandler {
 	return &InstanceHandler{
-		q:      q,
-		docker: docker.NewDockerManager(),
+		conn:      conn,
+		q:         q,
+		docker:    docker.NewDockerManager(),
+		sandboxes: sandboxes,
+		broker:    broker,
+	}
+}
+
+// createOwnedInstance inserts the instance together with its owner membership,
+// returning errOrgQuotaReached when its organization has no room for it.
+func (h *InstanceHandler) createOwnedInstance(c *gin.Context, arg db.CreateInstanceParams) (db.Instances, error) {
+	tx, err := h.conn.BeginTx(c, nil)
+	if err != nil {
+		return db.Instances{}, err
+	}
+	defer tx.Rollback()
+
+	qtx := h.q.WithTx(tx)
+
+	// CreateInstance checks the quota early, but concurrent creates all pass
+	// that check; holding the organization's row until commit makes them
+	// count one after another
+	if arg.OrgID.Valid {
+		org, err := qtx.LockOrganization(c, arg.OrgID.UUID)
+		if err != nil {
+			return db.Instances{}, err
+		}
+
+		full, err := orgQuotaReached(c, qtx, org, false)
+		if err != nil {
+			return db.Instances{}, err
+		}
+		if full {
+			return db.Instances{}, errOrgQuotaReached
+		}
+	}
+
+	inst, err := qtx.CreateInstance(c, arg)
+	if err != nil {
+		return db.Instances{}, err
+	}
+
+	if _, err := qtx.AddInstanceMember(c, db.AddInstanceMemberParams{
+		InstanceID: inst.ID,
+		UserID:     inst.UserID,
+		Role:       memberRoleOwner,
+	}); err != nil {
+		return db.Instances{}, err
 	}
+
+	return inst, tx.Commit()
 }
 
 
@@ -34,44 +102,67 @@ func (h *InstanceHandler) CreateInstance(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
+		badRequest(c, err)
 		return
 	}
 
 	userUUID, err := uuid.Parse(c.GetString("userID"))
 	if err != nil {
-		c.JSON(401, gin.H{"error": "unauthorized"})
+		respondError(c, 401, "unauthorized")
+		return
+	}
+
+	// fill in what the request leaves out from the user's saved defaults
+	profile, err := userProfile(c, h.q, userUUID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	if req.Type == "" && profile.DefaultInstanceType.Valid {
+		req.Type = profile.DefaultInstanceType.String
+	}
+	if req.TTLHours == 0 && profile.DefaultTtlHours.Valid {
+		req.TTLHours = profile.DefaultTtlHours.Int32
+	}
+	if !instanceTypes[req.Type] {
+		validationFailed(c, FieldError{Field: "type", Message: "unknown instance type"})
+		return
+	}
+
+	orgID, ok := sessionOrg(c, h.q, userUUID)
+	if !ok {
+		return
+	}
+	if orgID.Valid && !checkOrgQuota(c, h.q, orgID.UUID, false) {
 		return
 	}
 
 	instanceID := uuid.New()
 
 	dataPath := filepath.Join(
-		"/var/lib/ambilio",
+		dataRoot,
 		userUUID.String(),
 		instanceID.String(),
 	)
 
 	if err := os.MkdirAll(dataPath, 0755); err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		serverError(c, err)
 		return
 	}
 
 	if req.Type == "aws" {
-		awsSvc, err := docker.NewAWSService()
-		if err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
+		username, password, consoleURL, err :=
+			h.sandboxes.CreateSandboxUser(c.Request.Context(), instanceID.String())
+		if errors.Is(err, docker.ErrAWSNotConfigured) {
+			respondError(c, 503, "aws sandboxes are not configured")
 			return
 		}
-
-		username, password, consoleURL, err :=
-			awsSvc.CreateSandboxUser(c.Request.Context(), instanceID.String())
 		if err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
+			serverError(c, err)
 			return
 		}
 
-		inst, err := h.q.CreateInstance(c, db.CreateInstanceParams{
+		inst, err := h.createOwnedInstance(c, db.CreateInstanceParams{
 			ID:       instanceID,
 			UserID:   userUUID,
 			Type:     "aws",
@@ -81,47 +172,64 @@ func (h *InstanceHandler) CreateInstance(c *gin.Context) {
 			ConsoleUrl: sql.NullString{String: consoleURL, Valid: true},
 			AwsUsername: sql.NullString{String: username, Valid: true},
 			AwsPassword: sql.NullString{String: password, Valid: true},
+			OrgID:       orgID,
 		})
+		if errors.Is(err, errOrgQuotaReached) {
+			// nobody will log in as the sandbox user now
+			if err := h.sandboxes.DeleteSandboxUser(c.Request.Context(), username); err != nil {
+				slog.ErrorContext(c, "deleting sandbox user failed", "aws_username", username, "error", err)
+			}
+			respondError(c, 409, err.Error())
+			return
+		}
 		if err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
+			serverError(c, err)
 			return
 		}
+		// the console password is handed out in this response
+		auditInstance(c, h.q, uuid.NullUUID{UUID: userUUID, Valid: true}, inst, auditInstanceCreated, gin.H{
+			"type":               inst.Type,
+			"aws_username":       username,
+			"credentials_issued": true,
+		})
 
 		c.JSON(201, inst)
 		return
 	}
 
-	inst, err := h.q.CreateInstance(c, db.CreateInstanceParams{
+	inst, err := h.createOwnedInstance(c, db.CreateInstanceParams{
 		ID:       instanceID,
 		UserID:   userUUID,
 		Type:     req.Type,
 		EfsPath:  dataPath,
 		TtlHours: req.TTLHours,
+		OrgID:    orgID,
 	})
+	if errors.Is(err, errOrgQuotaReached) {
+		respondError(c, 409, err.Error())
+		return
+	}
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		serverError(c, err)
 		return
 	}
+	auditInstance(c, h.q, uuid.NullUUID{UUID: userUUID, Valid: true}, inst, auditInstanceCreated, gin.H{
+		"type":      inst.Type,
+		"ttl_hours": inst.TtlHours,
+	})
 
 	c.JSON(201, inst)
 }
 
 
 func (h *InstanceHandler) StartInstance(c *gin.Context) {
-	instanceID, err := uuid.Parse(c.Param("id"))
-	if err != nil {
-		c.JSON(400, gin.H{"error": "invalid instance id"})
-		return
-	}
-
-	inst, err := h.q.GetInstanceByID(c, instanceID)
-	if err != nil {
-		c.JSON(404, gin.H{"error": "instance not found"})
+	inst, userUUID, ok := h.authorizeInstance(c, memberRoleEditor)
+	if !ok {
 		return
 	}
 
 	if inst.Type == "aws" {
-		c.JSON(400, gin.H{"error": "aws instances do not start"})
+		respondError(c, 400, "aws instances do not start")
 		return
 	}
 
@@ -130,20 +238,30 @@ func (h *InstanceHandler) StartInstance(c *gin.Context) {
 		return
 	}
 
+	if inst.OrgID.Valid && !checkOrgQuota(c, h.q, inst.OrgID.UUID, true) {
+		return
+	}
+
+	// the event stream shows the caller how far the start has got
+	ctx := docker.WithProgress(c.Request.Context(), func(step string) {
+		events.Publish(c, h.q, events.Progress(inst, step))
+	})
+
 	result, err := h.docker.Run(
-		c.Request.Context(),
+		ctx,
 		inst.ID.String(),
 		inst.Type,
 		inst.EfsPath,
 	)
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		webhook.Notify(c, h.q, webhook.InstanceFailed, inst, map[string]any{"reason": "start_failed"})
+		serverError(c, err)
 		return
 	}
 
 	port, err := strconv.Atoi(result.HostPort)
 	if err != nil {
-		c.JSON(500, gin.H{"error": "invalid host port"})
+		respondError(c, 500, "invalid host port")
 		return
 	}
 
@@ -159,38 +277,40 @@ func (h *InstanceHandler) StartInstance(c *gin.Context) {
 		},
 	})
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		serverError(c, err)
 		return
 	}
+	auditInstance(c, h.q, uuid.NullUUID{UUID: userUUID, Valid: true}, inst, auditInstanceStarted, nil)
+	webhook.Notify(c, h.q, webhook.InstanceStarted, inst, nil)
 
 	c.JSON(200, inst)
 }
 
 
 func (h *InstanceHandler) StopInstance(c *gin.Context) {
-	instanceID, err := uuid.Parse(c.Param("id"))
-	if err != nil {
-		c.JSON(400, gin.H{"error": "invalid instance id"})
+	inst, userUUID, ok := h.authorizeInstance(c, memberRoleEditor)
+	if !ok {
 		return
 	}
 
-	inst, err := h.q.GetInstanceByID(c, instanceID)
-	if err != nil {
-		c.JSON(404, gin.H{"error": "instance not found"})
+	if inst.Type == "aws" {
+		respondError(c, 400, "aws instances cannot be stopped")
 		return
 	}
 
-	if inst.Type == "aws" {
-		c.JSON(400, gin.H{"error": "aws instances cannot be stopped"})
+	if err := h.docker.Stop(c, inst.ID.String(), inst.Type); err != nil {
+		serverError(c, err)
 		return
 	}
+	auditInstance(c, h.q, uuid.NullUUID{UUID: userUUID, Valid: true}, inst, auditInstanceStopped, nil)
 
-	h.docker.Stop(inst.ID.String(), inst.Type)
-
-	inst, _ = h.q.UpdateInstanceStatus(c, db.UpdateInstanceStatusParams{
+	inst, err := h.q.UpdateInstanceStatus(c, db.UpdateInstanceStatusParams{
 		ID:     inst.ID,
 		Status: "stopped",
 	})
+	if err == nil {
+		webhook.Notify(c, h.q, webhook.InstanceStopped, inst, map[string]any{"reason": "requested"})
+	}
 
 	c.JSON(200, inst)
 }
@@ -199,29 +319,87 @@ func (h *InstanceHandler) StopInstance(c *gin.Context) {
 func (h *InstanceHandler) ListInstances(c *gin.Context) {
 	userUUID, err := uuid.Parse(c.GetString("userID"))
 	if err != nil {
-		c.JSON(401, gin.H{"error": "unauthorized"})
+		respondError(c, 401, "unauthorized")
 		return
 	}
 
-	instances, err := h.q.ListUserInstances(c, userUUID)
+	visible, err := h.memberInstances(c, userUUID)
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		serverError(c, err)
 		return
 	}
 
-	c.JSON(200, instances)
+	// AWS console credentials are only handed out to owners, and each read
+	// is audited; editors and viewers see the instance without them
+	for i, inst := range visible {
+		if !inst.AwsPassword.Valid {
+			continue
+		}
+
+		role, err := instanceRole(c, h.q, inst, userUUID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			serverError(c, err)
+			return
+		}
+		if role != memberRoleOwner {
+			visible[i] = withoutCredentials(inst)
+			continue
+		}
+
+		auditInstance(c, h.q, uuid.NullUUID{UUID: userUUID, Valid: true}, inst, auditCredentialsRead, gin.H{"aws_username": inst.AwsUsername.String})
+	}
+
+	c.JSON(200, visible)
 }
 
 
-func (h *InstanceHandler) Heartbeat(c *gin.Context) {
-	instanceID, err := uuid.Parse(c.Param("id"))
+// withoutCredentials blanks the AWS console login, for responses to anyone
+// but the instance's owner.
+func withoutCredentials(inst db.Instances) db.Instances {
+	inst.AwsUsername = sql.NullString{}
+	inst.AwsPassword = sql.NullString{}
+	return inst
+}
+
+
+// memberInstances lists the instances the user is a member of, leaving out
+// those of organizations requiring MFA unless the caller passed it.
+func (h *InstanceHandler) memberInstances(c *gin.Context, userUUID uuid.UUID) ([]db.Instances, error) {
+	instances, err := h.q.ListMemberInstances(c, userUUID)
 	if err != nil {
-		c.JSON(400, gin.H{"error": "invalid instance id"})
+		return nil, err
+	}
+
+	mfaErr := map[uuid.UUID]error{}
+	visible := make([]db.Instances, 0, len(instances))
+	for _, inst := range instances {
+		if inst.OrgID.Valid {
+			err, checked := mfaErr[inst.OrgID.UUID]
+			if !checked {
+				err = checkOrgMFA(c, h.q, inst.OrgID.UUID)
+				mfaErr[inst.OrgID.UUID] = err
+			}
+			if errors.Is(err, errMFARequired) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		visible = append(visible, inst)
+	}
+	return visible, nil
+}
+
+
+func (h *InstanceHandler) Heartbeat(c *gin.Context) {
+	inst, _, ok := h.authorizeInstance(c, memberRoleViewer)
+	if !ok {
 		return
 	}
 
 	_, _ = h.q.UpdateLastActive(c, db.UpdateLastActiveParams{
-		ID:         instanceID,
+		ID:         inst.ID,
 		LastActive: time.Now(),
 	})
 
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	db "example.com/m/v2/db/sqlc"
+	"example.com/m/v2/util"
+)
+
+const (
+	defaultInviteHours = 7 * 24
+	maxInviteHours     = 90 * 24
+)
+
+type inviteResponse struct {
+	ID        uuid.UUID  `json:"id"`
+	Email     *string    `json:"email"`
+	MaxUses   int32      `json:"max_uses"`
+	Uses      int32      `json:"uses"`
+	CreatedBy *uuid.UUID `json:"created_by"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func newInviteResponse(inv db.SignupInvites) inviteResponse {
+	resp := inviteResponse{
+		ID:        inv.ID,
+		MaxUses:   inv.MaxUses,
+		Uses:      inv.Uses,
+		ExpiresAt: inv.ExpiresAt,
+		CreatedAt: inv.CreatedAt,
+	}
+	if inv.Email.Valid {
+		resp.Email = &inv.Email.String
+	}
+	if inv.CreatedBy.Valid {
+		resp.CreatedBy = &inv.CreatedBy.UUID
+	}
+	if inv.RevokedAt.Valid {
+		resp.RevokedAt = &inv.RevokedAt.Time
+	}
+	return resp
+}
+
+// CreateInvite issues a signup invite code. The code is only returned here.
+func (h *AdminHandler) CreateInvite(c *gin.Context) {
+	var req struct {
+		Email          string `json:"email"`
+		MaxUses        int32  `json:"max_uses"`
+		ExpiresInHours int32  `json:"expires_in_hours"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	req.Email = normalizeEmail(req.Email)
+	if req.Email != "" && !validEmail(req.Email) {
+		respondError(c, 400, "invalid email address")
+		return
+	}
+
+	if req.MaxUses == 0 {
+		req.MaxUses = 1
+	}
+	if req.MaxUses < 0 {
+		respondError(c, 400, "max_uses must be positive")
+		return
+	}
+
+	if req.ExpiresInHours == 0 {
+		req.ExpiresInHours = defaultInviteHours
+	}
+	if req.ExpiresInHours < 0 || req.ExpiresInHours > maxInviteHours {
+		respondError(c, 400, "expires_in_hours must be between 1 and 2160")
+		return
+	}
+
+	callerID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		respondError(c, 401, "unauthorized")
+		return
+	}
+
+	code, hash, err := util.NewToken()
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	inv, err := h.q.CreateSignupInvite(c, db.CreateSignupInviteParams{
+		CodeHash:  hash,
+		Email:     sql.NullString{String: req.Email, Valid: req.Email != ""},
+		MaxUses:   req.MaxUses,
+		CreatedBy: uuid.NullUUID{UUID: callerID, Valid: true},
+		ExpiresAt: time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour),
+	})
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	audit(c, h.q, uuid.NullUUID{UUID: callerID, Valid: true}, auditInviteCreated, inv.ID.String(), gin.H{
+		"email":      req.Email,
+		"max_uses":   inv.MaxUses,
+		"expires_at": inv.ExpiresAt,
+	})
+
+	c.JSON(201, gin.H{
+		"invite": newInviteResponse(inv),
+		"code":   code,
+	})
+}
+
+func (h *AdminHandler) ListInvites(c *gin.Context) {
+	invites, err := h.q.ListSignupInvites(c)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	resp := make([]inviteResponse, 0, len(invites))
+	for _, inv := range invites {
+		resp = append(resp, newInviteResponse(inv))
+	}
+
+	c.JSON(200, resp)
+}
+
+func (h *AdminHandler) RevokeInvite(c *gin.Context) {
+	inviteID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respondError(c, 400, "invalid invite id")
+		return
+	}
+
+	n, err := h.q.RevokeSignupInvite(c, inviteID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	if n == 0 {
+		respondError(c, 404, "invite not found")
+		return
+	}
+	audit(c, h.q, auditActor(c), auditInviteRevoked, inviteID.String(), nil)
+
+	c.JSON(200, gin.H{"ok": true})
+}
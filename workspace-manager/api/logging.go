@@ -0,0 +1,92 @@
+package api
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"example.com/m/v2/internal/logging"
+)
+
+// requestIDRe limits the request IDs we accept from upstream proxies to ones
+// that are safe to echo and log.
+var requestIDRe = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// instanceRoutes take an instance ID as :id.
+var instanceRoutes = []string{"/instances/:id", "/admin/instances/:id", "/workspaces/:id"}
+
+// requestLog tags the request's context with its request ID, and instance ID
+// where the route has one, so every record logged while serving it carries
+// them. It then writes one access log line per request.
+func requestLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		id := c.GetHeader("X-Request-Id")
+		if !requestIDRe.MatchString(id) {
+			id = uuid.NewString()
+		}
+		c.Header("X-Request-Id", id)
+		c.Set("requestID", id)
+
+		attrs := []slog.Attr{slog.String(logging.RequestIDKey, id)}
+		for _, prefix := range instanceRoutes {
+			if strings.HasPrefix(c.FullPath(), prefix) {
+				attrs = append(attrs, slog.String(logging.InstanceIDKey, c.Param("id")))
+				break
+			}
+		}
+		logWith(c, attrs...)
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case route == "/healthz" || route == "/readyz":
+			level = slog.LevelDebug // probes would drown everything else
+		}
+
+		slog.LogAttrs(c.Request.Context(), level, "request",
+			slog.String("method", c.Request.Method),
+			slog.String("route", route),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Int("bytes", c.Writer.Size()),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("client_ip", c.ClientIP()),
+			slog.String("user_agent", c.Request.UserAgent()),
+		)
+	}
+}
+
+// logWith adds attrs to every record logged for the rest of the request.
+func logWith(c *gin.Context, attrs ...slog.Attr) {
+	c.Request = c.Request.WithContext(logging.With(c.Request.Context(), attrs...))
+}
+
+// recoverPanics turns a panic into a 500 and logs it with its stack and the
+// request's correlation fields.
+func recoverPanics() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, err any) {
+		slog.ErrorContext(c.Request.Context(), "panic serving request",
+			"panic", err,
+			"stack", string(debug.Stack()),
+		)
+		respondError(c, http.StatusInternalServerError, "internal server error")
+	})
+}
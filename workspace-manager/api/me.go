@@ -0,0 +1,506 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	_ "time/tzdata" // timezone validation must not depend on the host
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	db "example.com/m/v2/db/sqlc"
+	"example.com/m/v2/internal/docker"
+	"example.com/m/v2/util"
+)
+
+const (
+	maxDisplayName = 100
+	maxAvatarURL   = 2048
+	maxDefaultTTL  = 720
+)
+
+// MeHandler serves the caller's own profile and account.
+type MeHandler struct {
+	conn      *sql.DB
+	q         *db.Queries
+	docker    *docker.DockerManager
+	sandboxes *docker.AWSService
+	exportDir string
+}
+
+func NewMeHandler(conn *sql.DB, q *db.Queries, cfg *util.Config, sandboxes *docker.AWSService) *MeHandler {
+	return &MeHandler{
+		conn:      conn,
+		q:         q,
+		docker:    docker.NewDockerManager(),
+		sandboxes: sandboxes,
+		exportDir: cfg.ExportDir,
+	}
+}
+
+type profileResponse struct {
+	ID                  uuid.UUID `json:"id"`
+	Email               string    `json:"email"`
+	EmailVerified       bool      `json:"email_verified"`
+	Role                string    `json:"role"`
+	MFAEnabled          bool      `json:"mfa_enabled"`
+	HasPassword         bool      `json:"has_password"`
+	DisplayName         string    `json:"display_name"`
+	AvatarURL           string    `json:"avatar_url"`
+	Timezone            string    `json:"timezone"`
+	DefaultInstanceType *string   `json:"default_instance_type"`
+	DefaultTTLHours     *int32    `json:"default_ttl_hours"`
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+// userProfile returns the stored profile, or the defaults for users who
+// never saved one.
+func userProfile(ctx context.Context, q *db.Queries, userID uuid.UUID) (db.UserProfiles, error) {
+	p, err := q.GetUserProfile(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return db.UserProfiles{UserID: userID, Timezone: "UTC"}, nil
+	}
+	return p, err
+}
+
+func (h *MeHandler) respond(c *gin.Context, u db.Users, p db.UserProfiles) {
+	mfa, err := mfaEnabled(c, h.q, u.ID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	resp := profileResponse{
+		ID:            u.ID,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerifiedAt.Valid,
+		Role:          u.Role,
+		MFAEnabled:    mfa,
+		HasPassword:   u.Password != "",
+		DisplayName:   p.DisplayName,
+		AvatarURL:     p.AvatarUrl,
+		Timezone:      p.Timezone,
+		CreatedAt:     u.CreatedAt,
+	}
+	if p.DefaultInstanceType.Valid {
+		resp.DefaultInstanceType = &p.DefaultInstanceType.String
+	}
+	if p.DefaultTtlHours.Valid {
+		resp.DefaultTTLHours = &p.DefaultTtlHours.Int32
+	}
+
+	c.JSON(200, resp)
+}
+
+func (h *MeHandler) Get(c *gin.Context) {
+	userID, ok := callerID(c)
+	if !ok {
+		return
+	}
+
+	u, err := h.q.GetUserByID(c, userID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	p, err := userProfile(c, h.q, userID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	h.respond(c, u, p)
+}
+
+// Update changes the fields present in the body. Sending null for a default
+// workspace setting clears it.
+func (h *MeHandler) Update(c *gin.Context) {
+	var req struct {
+		DisplayName         *string `json:"display_name"`
+		AvatarURL           *string `json:"avatar_url"`
+		Timezone            *string `json:"timezone"`
+		DefaultInstanceType *string `json:"default_instance_type"`
+		DefaultTTLHours     *int32  `json:"default_ttl_hours"`
+	}
+
+	// a second decode tells "absent" from "null" for the clearable fields
+	var present map[string]any
+	if err := c.ShouldBindBodyWithJSON(&present); err != nil {
+		badRequest(c, err)
+		return
+	}
+	if err := c.ShouldBindBodyWithJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	userID, ok := callerID(c)
+	if !ok {
+		return
+	}
+
+	p, err := userProfile(c, h.q, userID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	var problems []FieldError
+
+	if req.DisplayName != nil {
+		p.DisplayName = strings.TrimSpace(*req.DisplayName)
+		if len(p.DisplayName) > maxDisplayName {
+			problems = append(problems, FieldError{Field: "display_name", Message: "display name must be at most 100 characters"})
+		}
+	}
+
+	if req.AvatarURL != nil {
+		p.AvatarUrl = strings.TrimSpace(*req.AvatarURL)
+		if p.AvatarUrl != "" && !validAvatarURL(p.AvatarUrl) {
+			problems = append(problems, FieldError{Field: "avatar_url", Message: "avatar_url must be an https URL"})
+		}
+	}
+
+	if req.Timezone != nil {
+		p.Timezone = *req.Timezone
+		if _, err := time.LoadLocation(p.Timezone); err != nil || p.Timezone == "" || p.Timezone == "Local" {
+			problems = append(problems, FieldError{Field: "timezone", Message: "timezone must be an IANA name such as Europe/Berlin"})
+		}
+	}
+
+	if _, ok := present["default_instance_type"]; ok {
+		p.DefaultInstanceType = sql.NullString{}
+		if req.DefaultInstanceType != nil {
+			p.DefaultInstanceType = sql.NullString{String: *req.DefaultInstanceType, Valid: true}
+			if !instanceTypes[*req.DefaultInstanceType] {
+				problems = append(problems, FieldError{Field: "default_instance_type", Message: "unknown instance type"})
+			}
+		}
+	}
+
+	if _, ok := present["default_ttl_hours"]; ok {
+		p.DefaultTtlHours = sql.NullInt32{}
+		if req.DefaultTTLHours != nil {
+			p.DefaultTtlHours = sql.NullInt32{Int32: *req.DefaultTTLHours, Valid: true}
+			if *req.DefaultTTLHours < 1 || *req.DefaultTTLHours > maxDefaultTTL {
+				problems = append(problems, FieldError{Field: "default_ttl_hours", Message: "default_ttl_hours must be between 1 and 720"})
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		validationFailed(c, problems...)
+		return
+	}
+
+	p, err = h.q.UpsertUserProfile(c, db.UpsertUserProfileParams{
+		UserID:              userID,
+		DisplayName:         p.DisplayName,
+		AvatarUrl:           p.AvatarUrl,
+		Timezone:            p.Timezone,
+		DefaultInstanceType: p.DefaultInstanceType,
+		DefaultTtlHours:     p.DefaultTtlHours,
+	})
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	audit(c, h.q, uuid.NullUUID{UUID: userID, Valid: true}, auditProfileUpdated, userID.String(), gin.H{
+		"fields": slices.Sorted(maps.Keys(present)),
+	})
+
+	u, err := h.q.GetUserByID(c, userID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	h.respond(c, u, p)
+}
+
+func validAvatarURL(s string) bool {
+	if len(s) > maxAvatarURL {
+		return false
+	}
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme == "https" && u.Host != ""
+}
+
+// ChangePassword sets a new password after checking the current one, and
+// signs out every other session.
+func (h *MeHandler) ChangePassword(c *gin.Context) {
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	userID, ok := callerID(c)
+	if !ok {
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.GetString("sessionID"))
+	if err != nil {
+		respondError(c, 401, "unauthorized")
+		return
+	}
+
+	u, err := h.q.GetUserByID(c, userID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	if u.Password == "" {
+		respondError(c, 409, "account has no password; set one with a password reset")
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(req.CurrentPassword)) != nil {
+		respondError(c, 403, "current password is incorrect")
+		return
+	}
+
+	if weakPassword(c, req.NewPassword, u.Email) {
+		return
+	}
+
+	pwHash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	tx, err := h.conn.BeginTx(c, nil)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := h.q.WithTx(tx)
+
+	if err := qtx.UpdateUserPassword(c, db.UpdateUserPasswordParams{
+		ID:       userID,
+		Password: string(pwHash),
+	}); err != nil {
+		serverError(c, err)
+		return
+	}
+
+	if err := qtx.RevokeOtherUserSessions(c, db.RevokeOtherUserSessionsParams{
+		UserID: userID,
+		ID:     sessionID,
+	}); err != nil {
+		serverError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		serverError(c, err)
+		return
+	}
+
+	audit(c, h.q, uuid.NullUUID{UUID: userID, Valid: true}, auditPasswordChanged, userID.String(), nil)
+
+	c.JSON(200, gin.H{"ok": true})
+}
+
+// Delete removes the caller's account. Everything the account's personal
+// instances hold outside the database (containers, AWS sandbox users and data
+// directories) is released first, since ON DELETE CASCADE only removes rows.
+// Instances they created in organizations pass to another admin there.
+func (h *MeHandler) Delete(c *gin.Context) {
+	var req struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	userID, ok := callerID(c)
+	if !ok {
+		return
+	}
+
+	u, err := h.q.GetUserByID(c, userID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	// re-authenticate, so a stolen access token alone cannot delete a
+	// password account
+	if u.Password != "" && bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(req.Password)) != nil {
+		respondError(c, 403, "password is incorrect")
+		return
+	}
+
+	mfa, err := mfaEnabled(c, h.q, userID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	if mfa {
+		ok, locked, err := throttledSecondFactor(c, h.q, u, req.Code)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+		if locked > 0 {
+			respondLockedOut(c, locked)
+			return
+		}
+		if !ok {
+			respondErrorCode(c, 403, codeMFARequired, "a valid authentication code is required", nil)
+			return
+		}
+	}
+
+	blocked, err := h.soleAdminOrgs(c, userID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	if len(blocked) > 0 {
+		respondErrorCode(c, 409, codeConflict, "make someone else an admin of your organizations first", gin.H{"org_ids": blocked})
+		return
+	}
+
+	created, err := h.q.ListUserInstances(c, userID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	// organization instances stay with the organization, data included;
+	// only personal ones are torn down
+	var instances []db.Instances
+	keep := map[string]bool{}
+	for _, inst := range created {
+		if inst.OrgID.Valid {
+			keep[filepath.Clean(inst.EfsPath)] = true
+			continue
+		}
+		instances = append(instances, inst)
+	}
+
+	for _, inst := range instances {
+		if err := teardownInstance(c.Request.Context(), h.docker, h.sandboxes, inst, true); err != nil {
+			serverError(c, err)
+			return
+		}
+	}
+
+	// also catches directories whose instance row is already gone
+	if err := removeUserData(userID, keep); err != nil {
+		serverError(c, err)
+		return
+	}
+
+	tx, err := h.conn.BeginTx(c, nil)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := h.q.WithTx(tx)
+
+	if _, err := qtx.TransferOrgInstances(c, userID); err != nil {
+		serverError(c, err)
+		return
+	}
+	if err := qtx.DeleteUser(c, userID); err != nil {
+		serverError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		serverError(c, err)
+		return
+	}
+
+	// data export archives would otherwise wait out their expiry
+	if err := os.RemoveAll(filepath.Join(h.exportDir, userID.String())); err != nil {
+		slog.ErrorContext(c, "removing exports of deleted user failed", "deleted_user_id", userID, "error", err)
+	}
+
+	// the actor no longer exists, so the target names the account
+	audit(c, h.q, uuid.NullUUID{}, auditAccountDeleted, userID.String(), gin.H{
+		"email":     u.Email,
+		"instances": len(instances),
+	})
+
+	c.JSON(200, gin.H{"ok": true})
+}
+
+// removeUserData deletes the user's data directory, except for the instance
+// directories in keep.
+func removeUserData(userID uuid.UUID, keep map[string]bool) error {
+	dir := filepath.Join(dataRoot, userID.String())
+	if len(keep) == 0 {
+		return removeDataPath(dir)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if keep[path] {
+			continue
+		}
+		if err := removeDataPath(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// soleAdminOrgs lists the organizations that would be left without an admin
+// if the user left.
+func (h *MeHandler) soleAdminOrgs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	orgs, err := h.q.ListUserOrganizations(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	blocked := []uuid.UUID{}
+	for _, o := range orgs {
+		if o.Role != orgRoleAdmin {
+			continue
+		}
+		admins, err := h.q.CountOrgAdmins(ctx, o.ID)
+		if err != nil {
+			return nil, err
+		}
+		if admins < 2 {
+			blocked = append(blocked, o.ID)
+		}
+	}
+	return blocked, nil
+}
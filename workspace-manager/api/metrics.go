@@ -0,0 +1,113 @@
+package api
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"example.com/m/v2/internal/metrics"
+)
+
+// requestMetrics records the latency of every request under its route
+// template, so /instances/:id is one series rather than one per instance.
+func requestMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.HTTPRequestDuration.
+			WithLabelValues(methodLabel(c.Request.Method), route, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// methodLabel keeps the method label bounded: clients can send any method,
+// so only the standard ones get a series of their own.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions,
+		http.MethodConnect, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
+
+// proxyWriter counts the bytes a workspace proxy sends back to the client.
+// Upgraded connections are wrapped too, so WebSocket traffic is counted in
+// both directions.
+type proxyWriter struct {
+	http.ResponseWriter
+	in, out prometheus.Counter
+}
+
+func newProxyWriter(w http.ResponseWriter, workspaceType string) *proxyWriter {
+	return &proxyWriter{
+		ResponseWriter: w,
+		in:             metrics.ProxyBytes.WithLabelValues(workspaceType, "in"),
+		out:            metrics.ProxyBytes.WithLabelValues(workspaceType, "out"),
+	}
+}
+
+func (w *proxyWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.out.Add(float64(n))
+	return n, err
+}
+
+func (w *proxyWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *proxyWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	return &countingConn{Conn: conn, in: w.in, out: w.out}, rw, nil
+}
+
+func (w *proxyWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// countingBody counts request bytes read on their way to a workspace.
+type countingBody struct {
+	io.ReadCloser
+	in prometheus.Counter
+}
+
+func (b countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.in.Add(float64(n))
+	return n, err
+}
+
+type countingConn struct {
+	net.Conn
+	in, out prometheus.Counter
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.in.Add(float64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.out.Add(float64(n))
+	return n, err
+}
@@ -0,0 +1,479 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	db "example.com/m/v2/db/sqlc"
+	"example.com/m/v2/util"
+)
+
+const (
+	totpIssuer = "Ambilio"
+
+	recoveryCodeCount = 10
+
+	mfaChallengeTTL = 5 * time.Minute
+	maxMFAAttempts  = 5
+)
+
+// MFAHandler manages TOTP enrollment and the second login step.
+type MFAHandler struct {
+	conn *sql.DB
+	q    *db.Queries
+}
+
+func NewMFAHandler(conn *sql.DB, q *db.Queries) *MFAHandler {
+	return &MFAHandler{conn: conn, q: q}
+}
+
+// mfaEnabled reports whether the user has a confirmed TOTP enrollment.
+func mfaEnabled(ctx context.Context, q *db.Queries, userID uuid.UUID) (bool, error) {
+	m, err := q.GetUserMFA(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return m.EnabledAt.Valid, nil
+}
+
+// orgRequiresMFA reports whether sessions in orgID must have passed MFA.
+func orgRequiresMFA(ctx context.Context, q *db.Queries, orgID uuid.NullUUID) (bool, error) {
+	if !orgID.Valid {
+		return false, nil
+	}
+	org, err := q.GetOrganization(ctx, orgID.UUID)
+	if err != nil {
+		return false, err
+	}
+	return org.RequireMfa, nil
+}
+
+// beginMFAChallenge parks a password-verified login until the second factor
+// is presented, returning the token the client sends back with the code.
+func beginMFAChallenge(ctx context.Context, q *db.Queries, userID uuid.UUID, orgID uuid.NullUUID) (string, error) {
+	token, hash, err := util.NewToken()
+	if err != nil {
+		return "", err
+	}
+
+	if err := q.CreateMFAChallenge(ctx, db.CreateMFAChallengeParams{
+		TokenHash: hash,
+		UserID:    userID,
+		OrgID:     orgID,
+		ExpiresAt: time.Now().Add(mfaChallengeTTL),
+	}); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused
+// recovery code. Each is only accepted once.
+func verifySecondFactor(ctx context.Context, q *db.Queries, userID uuid.UUID, code string) (bool, error) {
+	m, err := q.GetUserMFA(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if step, ok := util.ValidateTOTP(m.Secret, code, time.Now()); ok {
+		used, err := q.UseMFAStep(ctx, db.UseMFAStepParams{
+			UserID:       userID,
+			LastUsedStep: step,
+		})
+		return used == 1, err
+	}
+
+	if !m.EnabledAt.Valid {
+		return false, nil
+	}
+
+	used, err := q.UseRecoveryCode(ctx, db.UseRecoveryCodeParams{
+		UserID:   userID,
+		CodeHash: util.HashToken(util.NormalizeRecoveryCode(code)),
+	})
+	return used == 1, err
+}
+
+// throttledSecondFactor is verifySecondFactor under the login throttle, so
+// the six digits cannot be guessed by spreading attempts across challenges
+// or endpoints. Wrong codes count as failed logins for the caller's IP and
+// the account; while either is locked out no code is checked and locked is
+// how much longer that lasts.
+func throttledSecondFactor(c *gin.Context, q *db.Queries, u db.Users, code string) (ok bool, locked time.Duration, err error) {
+	locked, err = loginLockout(c, q, c.ClientIP(), u.Email)
+	if err != nil || locked > 0 {
+		return false, locked, err
+	}
+
+	ok, err = verifySecondFactor(c, q, u.ID, code)
+	if err != nil || ok {
+		return ok, 0, err
+	}
+	return false, 0, recordLoginFailure(c, q, c.ClientIP(), u.Email)
+}
+
+// LoginMFA completes a login that was answered with mfa_required.
+func (h *MFAHandler) LoginMFA(c *gin.Context) {
+	var req struct {
+		MFAToken string `json:"mfa_token"`
+		Code     string `json:"code"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	hash := util.HashToken(req.MFAToken)
+
+	challenge, err := h.q.AttemptMFAChallenge(c, hash)
+	if err != nil {
+		respondError(c, 401, "login expired, start again")
+		return
+	}
+	if challenge.Attempts > maxMFAAttempts {
+		_ = h.q.DeleteMFAChallenge(c, hash)
+		respondError(c, 401, "too many attempts, start again")
+		return
+	}
+
+	u, err := h.q.GetUserByID(c, challenge.UserID)
+	if err != nil || u.DisabledAt.Valid {
+		respondError(c, 403, "account disabled")
+		return
+	}
+
+	ok, locked, err := throttledSecondFactor(c, h.q, u, req.Code)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	if locked > 0 {
+		audit(c, h.q, uuid.NullUUID{UUID: u.ID, Valid: true}, auditLoginLocked, u.Email, gin.H{"stage": "mfa"})
+		respondLockedOut(c, locked)
+		return
+	}
+	if !ok {
+		audit(c, h.q, uuid.NullUUID{UUID: u.ID, Valid: true}, auditLoginFailed, u.Email, gin.H{"stage": "mfa"})
+		respondError(c, 401, "invalid code")
+		return
+	}
+
+	if err := h.q.DeleteMFAChallenge(c, hash); err != nil {
+		serverError(c, err)
+		return
+	}
+	if err := clearAccountThrottle(c, h.q, u.Email); err != nil {
+		serverError(c, err)
+		return
+	}
+
+	tokens, err := startSession(c, h.q, u, challenge.OrgID, true)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	c.JSON(200, tokens)
+}
+
+func (h *MFAHandler) Status(c *gin.Context) {
+	userID, ok := callerID(c)
+	if !ok {
+		return
+	}
+
+	enabled, err := mfaEnabled(c, h.q, userID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	remaining, err := h.q.CountRecoveryCodes(c, userID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"enabled":                  enabled,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// Enroll starts (or restarts) TOTP enrollment. MFA is not enforced until
+// the user proves their authenticator works via Confirm.
+func (h *MFAHandler) Enroll(c *gin.Context) {
+	userID, ok := callerID(c)
+	if !ok {
+		return
+	}
+
+	u, err := h.q.GetUserByID(c, userID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	secret, err := util.NewTOTPSecret()
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	m, err := h.q.StartMFAEnrollment(c, db.StartMFAEnrollmentParams{
+		UserID: userID,
+		Secret: secret,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(c, 409, "mfa already enabled")
+		return
+	}
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	audit(c, h.q, uuid.NullUUID{UUID: userID, Valid: true}, auditMFAEnrollStarted, userID.String(), nil)
+
+	c.JSON(200, gin.H{
+		"secret":           m.Secret,
+		"provisioning_uri": util.TOTPURI(totpIssuer, u.Email, m.Secret),
+	})
+}
+
+// Confirm enables MFA once the user enters a code from their authenticator,
+// and returns recovery codes. They are only shown this once.
+func (h *MFAHandler) Confirm(c *gin.Context) {
+	var req struct {
+		Code string `json:"code"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	userID, ok := callerID(c)
+	if !ok {
+		return
+	}
+
+	m, err := h.q.GetUserMFA(c, userID)
+	if err != nil {
+		respondError(c, 400, "start enrollment first")
+		return
+	}
+	if m.EnabledAt.Valid {
+		respondError(c, 409, "mfa already enabled")
+		return
+	}
+
+	u, err := h.q.GetUserByID(c, userID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	ok, locked, err := throttledSecondFactor(c, h.q, u, req.Code)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	if locked > 0 {
+		respondLockedOut(c, locked)
+		return
+	}
+	if !ok {
+		respondError(c, 400, "invalid code")
+		return
+	}
+
+	codes, err := h.enable(c, userID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	audit(c, h.q, uuid.NullUUID{UUID: userID, Valid: true}, auditMFAEnabled, userID.String(), nil)
+
+	c.JSON(200, gin.H{"recovery_codes": codes})
+}
+
+func (h *MFAHandler) enable(c *gin.Context, userID uuid.UUID) ([]string, error) {
+	tx, err := h.conn.BeginTx(c, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	qtx := h.q.WithTx(tx)
+
+	if err := qtx.EnableMFA(c, userID); err != nil {
+		return nil, err
+	}
+
+	codes, err := replaceRecoveryCodes(c, qtx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, tx.Commit()
+}
+
+func replaceRecoveryCodes(ctx context.Context, q *db.Queries, userID uuid.UUID) ([]string, error) {
+	if err := q.DeleteRecoveryCodes(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := util.NewRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := q.CreateRecoveryCode(ctx, db.CreateRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: util.HashToken(util.NormalizeRecoveryCode(code)),
+		}); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes. It needs a current
+// code so a stolen session alone cannot mint new ones.
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID, ok := h.requireCode(c)
+	if !ok {
+		return
+	}
+
+	tx, err := h.conn.BeginTx(c, nil)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	codes, err := replaceRecoveryCodes(c, h.q.WithTx(tx), userID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		serverError(c, err)
+		return
+	}
+	audit(c, h.q, uuid.NullUUID{UUID: userID, Valid: true}, auditRecoveryCodesRenewed, userID.String(), nil)
+
+	c.JSON(200, gin.H{"recovery_codes": codes})
+}
+
+// Disable turns MFA off. It needs a current code, like regeneration.
+func (h *MFAHandler) Disable(c *gin.Context) {
+	userID, ok := h.requireCode(c)
+	if !ok {
+		return
+	}
+
+	tx, err := h.conn.BeginTx(c, nil)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := h.q.WithTx(tx)
+
+	if err := qtx.DeleteRecoveryCodes(c, userID); err != nil {
+		serverError(c, err)
+		return
+	}
+	if err := qtx.DeleteUserMFA(c, userID); err != nil {
+		serverError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		serverError(c, err)
+		return
+	}
+	audit(c, h.q, uuid.NullUUID{UUID: userID, Valid: true}, auditMFADisabled, userID.String(), nil)
+
+	c.JSON(200, gin.H{"ok": true})
+}
+
+// requireCode checks the {code} body against the caller's enabled MFA,
+// under the login throttle.
+func (h *MFAHandler) requireCode(c *gin.Context) (uuid.UUID, bool) {
+	var req struct {
+		Code string `json:"code"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return uuid.Nil, false
+	}
+
+	userID, ok := callerID(c)
+	if !ok {
+		return uuid.Nil, false
+	}
+
+	enabled, err := mfaEnabled(c, h.q, userID)
+	if err != nil {
+		serverError(c, err)
+		return uuid.Nil, false
+	}
+	if !enabled {
+		respondError(c, 400, "mfa is not enabled")
+		return uuid.Nil, false
+	}
+
+	u, err := h.q.GetUserByID(c, userID)
+	if err != nil {
+		serverError(c, err)
+		return uuid.Nil, false
+	}
+
+	ok, locked, err := throttledSecondFactor(c, h.q, u, req.Code)
+	if err != nil {
+		serverError(c, err)
+		return uuid.Nil, false
+	}
+	if locked > 0 {
+		respondLockedOut(c, locked)
+		return uuid.Nil, false
+	}
+	if !ok {
+		respondError(c, 400, "invalid code")
+		return uuid.Nil, false
+	}
+
+	return userID, true
+}
+
+func callerID(c *gin.Context) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		respondError(c, 401, "unauthorized")
+		return uuid.Nil, false
+	}
+	return userID, true
+}
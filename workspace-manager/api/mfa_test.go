@@ -0,0 +1,165 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	db "example.com/m/v2/db/sqlc"
+	"example.com/m/v2/util"
+)
+
+const testPassword = "correct horse battery staple"
+
+// testMFAUser creates a user with a password and MFA enabled, and returns
+// one of their recovery codes.
+func testMFAUser(t *testing.T, q *db.Queries) (db.Users, string) {
+	t.Helper()
+	ctx := context.Background()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := q.CreateUser(ctx, db.CreateUserParams{
+		Email:    uuid.NewString() + "@example.com",
+		Password: string(hash),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := util.NewTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.StartMFAEnrollment(ctx, db.StartMFAEnrollmentParams{UserID: u.ID, Secret: secret}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.EnableMFA(ctx, u.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := util.NewRecoveryCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.CreateRecoveryCode(ctx, db.CreateRecoveryCodeParams{
+		UserID:   u.ID,
+		CodeHash: util.HashToken(util.NormalizeRecoveryCode(code)),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the test requests all come from httptest's address, so start its
+	// counter afresh
+	if err := q.ClearLoginThrottle(ctx, loginThrottles("192.0.2.1", "")[0].key); err != nil {
+		t.Fatal(err)
+	}
+	return u, code
+}
+
+func loginMFA(t *testing.T, q *db.Queries, u db.Users, code string) int {
+	t.Helper()
+
+	token, err := beginMFAChallenge(context.Background(), q, u.ID, uuid.NullUUID{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := serve(t, "POST", "/login/mfa", "/login/mfa", gin.H{"mfa_token": token, "code": code},
+		db.Sessions{}, NewMFAHandler(nil, q).LoginMFA)
+	return w.Code
+}
+
+func TestLoginMFALockout(t *testing.T) {
+	_, q := testDB(t)
+	u, code := testMFAUser(t, q)
+
+	// each wrong code counts, however many challenges they are spread over
+	for i := 0; i < accountFreeAttempts; i++ {
+		if status := loginMFA(t, q, u, "000000"); status != 401 {
+			t.Fatalf("wrong code %d: status = %d, want 401", i, status)
+		}
+	}
+
+	if status := loginMFA(t, q, u, code); status != 429 {
+		t.Errorf("right code while locked out: status = %d, want 429", status)
+	}
+	remaining, err := q.CountRecoveryCodes(context.Background(), u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remaining != 1 {
+		t.Errorf("recovery code checked while locked out")
+	}
+
+	// nor can new challenges be started
+	w := serve(t, "POST", "/login", "/login", gin.H{"email": u.Email, "password": testPassword},
+		db.Sessions{}, LoginHandler(q))
+	if w.Code != 429 {
+		t.Errorf("password login while locked out: status = %d, want 429", w.Code)
+	}
+}
+
+func TestLoginKeepsThrottleUntilMFA(t *testing.T) {
+	_, q := testDB(t)
+	ctx := context.Background()
+	u, code := testMFAUser(t, q)
+	accountKey := loginThrottles("", u.Email)[1].key
+
+	login := func(password string) int {
+		w := serve(t, "POST", "/login", "/login", gin.H{"email": u.Email, "password": password},
+			db.Sessions{}, LoginHandler(q))
+		return w.Code
+	}
+
+	if status := login("wrong"); status != 401 {
+		t.Fatalf("wrong password: status = %d, want 401", status)
+	}
+	if status := login(testPassword); status != 200 {
+		t.Fatalf("right password: status = %d, want 200", status)
+	}
+	if _, err := q.GetLoginThrottle(ctx, accountKey); err != nil {
+		t.Errorf("throttle cleared before the second factor: %v", err)
+	}
+
+	if status := loginMFA(t, q, u, code); status != 200 {
+		t.Fatalf("right code: status = %d, want 200", status)
+	}
+	if _, err := q.GetLoginThrottle(ctx, accountKey); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("throttle kept after a full login: %v", err)
+	}
+}
+
+func TestRequireCodeLockout(t *testing.T) {
+	conn, q := testDB(t)
+	u, code := testMFAUser(t, q)
+	sess := testSession(t, q, u, true)
+	h := NewMFAHandler(conn, q)
+
+	disable := func(code string) int {
+		return serve(t, "POST", "/mfa/totp/disable", "/mfa/totp/disable", gin.H{"code": code}, sess, h.Disable).Code
+	}
+
+	for i := 0; i < accountFreeAttempts; i++ {
+		if status := disable("000000"); status != 400 {
+			t.Fatalf("wrong code %d: status = %d, want 400", i, status)
+		}
+	}
+	if status := disable(code); status != 429 {
+		t.Errorf("right code while locked out: status = %d, want 429", status)
+	}
+
+	enabled, err := mfaEnabled(context.Background(), q, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !enabled {
+		t.Error("mfa disabled while locked out")
+	}
+}
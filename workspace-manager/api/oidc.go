@@ -0,0 +1,296 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+
+	db "example.com/m/v2/db/sqlc"
+	"example.com/m/v2/util"
+)
+
+// oidcLoginTTL bounds how long the user may take at the identity provider.
+const oidcLoginTTL = 10 * time.Minute
+
+// oidcStateCookie holds the hash of the login's state in the browser that
+// started it, so a callback URL handed to someone else does not sign them
+// in.
+const (
+	oidcStateCookie = "oidc_state"
+	oidcCookiePath  = "/auth/oidc"
+)
+
+// OIDCHandler implements single sign-on with the authorization code flow and
+// PKCE against the configured issuer.
+type OIDCHandler struct {
+	conn *sql.DB
+	q    *db.Queries
+	cfg  *util.Config
+
+	// discovery is lazy so an unreachable provider does not stop the API
+	// from starting
+	mu       sync.Mutex
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+func NewOIDCHandler(conn *sql.DB, q *db.Queries, cfg *util.Config) *OIDCHandler {
+	return &OIDCHandler{conn: conn, q: q, cfg: cfg}
+}
+
+func (h *OIDCHandler) provider(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.oauth != nil {
+		return h.oauth, h.verifier, nil
+	}
+
+	p, err := oidc.NewProvider(ctx, h.cfg.OIDCIssuer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	h.oauth = &oauth2.Config{
+		ClientID:     h.cfg.OIDCClientID,
+		ClientSecret: h.cfg.OIDCClientSecret,
+		RedirectURL:  h.cfg.OIDCRedirectURL,
+		Endpoint:     p.Endpoint(),
+		Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+	}
+	h.verifier = p.Verifier(&oidc.Config{ClientID: h.cfg.OIDCClientID})
+
+	return h.oauth, h.verifier, nil
+}
+
+// Login redirects the browser to the identity provider.
+func (h *OIDCHandler) Login(c *gin.Context) {
+	oauth, _, err := h.provider(c)
+	if err != nil {
+		respondError(c, 502, "identity provider unavailable")
+		return
+	}
+
+	state, stateHash, err := util.NewToken()
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	nonce, _, err := util.NewToken()
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	// abandoned logins are cleared here rather than by a worker
+	if err := h.q.DeleteExpiredOIDCAuthRequests(c); err != nil {
+		serverError(c, err)
+		return
+	}
+
+	if err := h.q.CreateOIDCAuthRequest(c, db.CreateOIDCAuthRequestParams{
+		StateHash:    stateHash,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		ExpiresAt:    time.Now().Add(oidcLoginTTL),
+	}); err != nil {
+		serverError(c, err)
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, stateHash, int(oidcLoginTTL.Seconds()), oidcCookiePath, "", c.Request.TLS != nil, true)
+
+	c.Redirect(302, oauth.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier), oidc.Nonce(nonce)))
+}
+
+// Callback finishes the login: it exchanges the code, verifies the ID token
+// and signs the user in, creating or linking their account as needed.
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	if e := c.Query("error"); e != "" {
+		respondError(c, 401, "identity provider: "+e)
+		return
+	}
+
+	oauth, verifier, err := h.provider(c)
+	if err != nil {
+		respondError(c, 502, "identity provider unavailable")
+		return
+	}
+
+	stateHash := util.HashToken(c.Query("state"))
+	cookie, _ := c.Cookie(oidcStateCookie)
+	if subtle.ConstantTimeCompare([]byte(cookie), []byte(stateHash)) != 1 {
+		respondError(c, 400, "login was started in another browser, start again")
+		return
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, "", -1, oidcCookiePath, "", c.Request.TLS != nil, true)
+
+	// consuming the request makes each state single-use
+	req, err := h.q.ConsumeOIDCAuthRequest(c, stateHash)
+	if err != nil || time.Now().After(req.ExpiresAt) {
+		respondError(c, 400, "login expired, start again")
+		return
+	}
+
+	tok, err := oauth.Exchange(c, c.Query("code"), oauth2.VerifierOption(req.CodeVerifier))
+	if err != nil {
+		respondError(c, 401, "code exchange failed")
+		return
+	}
+
+	rawID, ok := tok.Extra("id_token").(string)
+	if !ok {
+		respondError(c, 401, "no id_token in response")
+		return
+	}
+
+	idToken, err := verifier.Verify(c, rawID)
+	if err != nil {
+		respondError(c, 401, "invalid id_token")
+		return
+	}
+	if idToken.Nonce != req.Nonce {
+		respondError(c, 401, "invalid nonce")
+		return
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		respondError(c, 401, err.Error())
+		return
+	}
+
+	u, status, err := h.resolveUser(c, idToken.Issuer, idToken.Subject, claims.Email, claims.EmailVerified)
+	if err != nil && status == 500 {
+		serverError(c, err)
+		return
+	}
+	if err != nil {
+		respondError(c, status, err.Error())
+		return
+	}
+
+	if u.DisabledAt.Valid {
+		respondError(c, 403, "account disabled")
+		return
+	}
+
+	// TOTP still applies on top of the provider's own checks
+	mfa, err := mfaEnabled(c, h.q, u.ID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	var resp gin.H
+	if mfa {
+		mfaToken, err := beginMFAChallenge(c, h.q, u.ID, uuid.NullUUID{})
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+		resp = gin.H{"mfa_required": true, "mfa_token": mfaToken}
+	} else {
+		resp, err = startSession(c, h.q, u, uuid.NullUUID{}, false)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+	}
+
+	if h.cfg.OIDCPostLoginURL == "" {
+		c.JSON(200, resp)
+		return
+	}
+
+	// the fragment never reaches servers or logs on the way to the frontend
+	frag := url.Values{}
+	for k, v := range resp {
+		frag.Set(k, fmt.Sprint(v))
+	}
+	c.Redirect(302, h.cfg.OIDCPostLoginURL+"#"+frag.Encode())
+}
+
+// resolveUser finds the account for an external identity. Unknown identities
+// are linked to the account with the same email when the provider has
+// verified it, and otherwise get a new account.
+func (h *OIDCHandler) resolveUser(c *gin.Context, issuer, subject, email string, verified bool) (db.Users, int, error) {
+	ident, err := h.q.GetUserIdentity(c, db.GetUserIdentityParams{
+		Issuer:  issuer,
+		Subject: subject,
+	})
+	if err == nil {
+		u, err := h.q.GetUserByID(c, ident.UserID)
+		return u, 500, err
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return db.Users{}, 500, err
+	}
+
+	email = normalizeEmail(email)
+	if email == "" {
+		return db.Users{}, 400, errors.New("identity provider did not share an email address")
+	}
+
+	tx, err := h.conn.BeginTx(c, nil)
+	if err != nil {
+		return db.Users{}, 500, err
+	}
+	defer tx.Rollback()
+
+	qtx := h.q.WithTx(tx)
+
+	u, err := qtx.GetUserByEmail(c, email)
+	switch {
+	case err == nil && !verified:
+		return db.Users{}, 409, errors.New("an account with this email exists; log in with your password")
+	case errors.Is(err, sql.ErrNoRows):
+		// SSO accounts have no password. Signup policy does not apply: the
+		// identity provider decides who may log in.
+		u, err = qtx.CreateUser(c, db.CreateUserParams{Email: email})
+		if err != nil {
+			return db.Users{}, 500, err
+		}
+	case err != nil:
+		return db.Users{}, 500, err
+	}
+
+	if verified {
+		if err := qtx.MarkEmailVerified(c, u.ID); err != nil {
+			return db.Users{}, 500, err
+		}
+	}
+
+	if _, err := qtx.CreateUserIdentity(c, db.CreateUserIdentityParams{
+		Issuer:  issuer,
+		Subject: subject,
+		UserID:  u.ID,
+		Email:   email,
+	}); err != nil {
+		return db.Users{}, 500, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return db.Users{}, 500, err
+	}
+	audit(c, h.q, uuid.NullUUID{UUID: u.ID, Valid: true}, auditIdentityLinked, issuer, gin.H{"subject": subject})
+
+	return u, 200, nil
+}
@@ -0,0 +1,605 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	db "example.com/m/v2/db/sqlc"
+	"example.com/m/v2/util"
+)
+
+const (
+	orgRoleAdmin  = "admin"
+	orgRoleMember = "member"
+)
+
+type OrgHandler struct {
+	conn *sql.DB
+	q    *db.Queries
+}
+
+func NewOrgHandler(conn *sql.DB, q *db.Queries) *OrgHandler {
+	return &OrgHandler{
+		conn: conn,
+		q:    q,
+	}
+}
+
+// authorizeOrg loads the organization named by the :id param and checks the
+// caller's membership. With adminOnly it also requires the admin role.
+func (h *OrgHandler) authorizeOrg(c *gin.Context, adminOnly bool) (db.Organizations, uuid.UUID, bool) {
+	userUUID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		respondError(c, 401, "unauthorized")
+		return db.Organizations{}, uuid.Nil, false
+	}
+
+	orgID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respondError(c, 400, "invalid organization id")
+		return db.Organizations{}, uuid.Nil, false
+	}
+
+	member, err := h.q.GetOrgMember(c, db.GetOrgMemberParams{
+		OrgID:  orgID,
+		UserID: userUUID,
+	})
+	if err != nil {
+		respondError(c, 404, "organization not found")
+		return db.Organizations{}, uuid.Nil, false
+	}
+
+	if adminOnly && member.Role != orgRoleAdmin {
+		respondError(c, 403, "requires admin role")
+		return db.Organizations{}, uuid.Nil, false
+	}
+
+	org, err := h.q.GetOrganization(c, orgID)
+	if err != nil {
+		respondError(c, 404, "organization not found")
+		return db.Organizations{}, uuid.Nil, false
+	}
+
+	if org.RequireMfa && !c.GetBool("mfaVerified") {
+		respondMFARequired(c)
+		return db.Organizations{}, uuid.Nil, false
+	}
+
+	return org, userUUID, true
+}
+
+func (h *OrgHandler) CreateOrg(c *gin.Context) {
+	var req struct {
+		Name string `json:"name"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		respondError(c, 400, "name is required")
+		return
+	}
+
+	userUUID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		respondError(c, 401, "unauthorized")
+		return
+	}
+
+	tx, err := h.conn.BeginTx(c, nil)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := h.q.WithTx(tx)
+
+	org, err := qtx.CreateOrganization(c, req.Name)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	if _, err := qtx.AddOrgMember(c, db.AddOrgMemberParams{
+		OrgID:  org.ID,
+		UserID: userUUID,
+		Role:   orgRoleAdmin,
+	}); err != nil {
+		serverError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		serverError(c, err)
+		return
+	}
+	audit(c, h.q, uuid.NullUUID{UUID: userUUID, Valid: true}, auditOrgCreated, org.ID.String(), gin.H{"name": org.Name})
+
+	c.JSON(201, org)
+}
+
+func (h *OrgHandler) ListOrgs(c *gin.Context) {
+	userUUID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		respondError(c, 401, "unauthorized")
+		return
+	}
+
+	orgs, err := h.q.ListUserOrganizations(c, userUUID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	c.JSON(200, orgs)
+}
+
+func (h *OrgHandler) GetOrg(c *gin.Context) {
+	org, _, ok := h.authorizeOrg(c, false)
+	if !ok {
+		return
+	}
+
+	c.JSON(200, org)
+}
+
+func (h *OrgHandler) UpdateQuota(c *gin.Context) {
+	var req struct {
+		MaxInstances        *int32 `json:"max_instances"`
+		MaxRunningInstances *int32 `json:"max_running_instances"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if (req.MaxInstances != nil && *req.MaxInstances < 0) ||
+		(req.MaxRunningInstances != nil && *req.MaxRunningInstances < 0) {
+		respondError(c, 400, "quotas cannot be negative")
+		return
+	}
+
+	org, callerID, ok := h.authorizeOrg(c, true)
+	if !ok {
+		return
+	}
+
+	org, err := h.q.UpdateOrganizationQuota(c, db.UpdateOrganizationQuotaParams{
+		ID:                  org.ID,
+		MaxInstances:        nullInt32(req.MaxInstances),
+		MaxRunningInstances: nullInt32(req.MaxRunningInstances),
+	})
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	audit(c, h.q, uuid.NullUUID{UUID: callerID, Valid: true}, auditOrgQuotaUpdated, org.ID.String(), gin.H{
+		"max_instances":         req.MaxInstances,
+		"max_running_instances": req.MaxRunningInstances,
+	})
+
+	c.JSON(200, org)
+}
+
+// SetRequireMFA makes org sessions require a login that passed MFA. The
+// admin turning it on must have MFA themselves so they are not locked out.
+func (h *OrgHandler) SetRequireMFA(c *gin.Context) {
+	var req struct {
+		Require bool `json:"require"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	org, callerID, ok := h.authorizeOrg(c, true)
+	if !ok {
+		return
+	}
+
+	if req.Require {
+		enabled, err := mfaEnabled(c, h.q, callerID)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+		if !enabled {
+			respondError(c, 409, "enable multi-factor authentication on your own account first")
+			return
+		}
+	}
+
+	org, err := h.q.SetOrganizationRequireMFA(c, db.SetOrganizationRequireMFAParams{
+		ID:         org.ID,
+		RequireMfa: req.Require,
+	})
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	audit(c, h.q, uuid.NullUUID{UUID: callerID, Valid: true}, auditOrgMFAUpdated, org.ID.String(), gin.H{"require": req.Require})
+
+	c.JSON(200, org)
+}
+
+func (h *OrgHandler) ListMembers(c *gin.Context) {
+	org, _, ok := h.authorizeOrg(c, false)
+	if !ok {
+		return
+	}
+
+	members, err := h.q.ListOrgMembers(c, org.ID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	c.JSON(200, members)
+}
+
+func (h *OrgHandler) AddMember(c *gin.Context) {
+	var req struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = orgRoleMember
+	}
+	if req.Role != orgRoleAdmin && req.Role != orgRoleMember {
+		respondError(c, 400, "role must be admin or member")
+		return
+	}
+
+	org, callerID, ok := h.authorizeOrg(c, true)
+	if !ok {
+		return
+	}
+
+	user, err := h.q.GetUserByEmail(c, normalizeEmail(req.Email))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(c, 404, "no user with that email")
+		return
+	}
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	member, err := h.q.AddOrgMember(c, db.AddOrgMemberParams{
+		OrgID:  org.ID,
+		UserID: user.ID,
+		Role:   req.Role,
+	})
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	auditSubject(c, h.q, uuid.NullUUID{UUID: callerID, Valid: true}, user.ID, auditOrgMemberAdded, org.ID.String(), gin.H{"role": req.Role})
+
+	c.JSON(201, member)
+}
+
+func (h *OrgHandler) UpdateMember(c *gin.Context) {
+	var req struct {
+		Role string `json:"role"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if req.Role != orgRoleAdmin && req.Role != orgRoleMember {
+		respondError(c, 400, "role must be admin or member")
+		return
+	}
+
+	memberID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		respondError(c, 400, "invalid user id")
+		return
+	}
+
+	org, callerID, ok := h.authorizeOrg(c, true)
+	if !ok {
+		return
+	}
+
+	current, err := h.q.GetOrgMember(c, db.GetOrgMemberParams{
+		OrgID:  org.ID,
+		UserID: memberID,
+	})
+	if err != nil {
+		respondError(c, 404, "member not found")
+		return
+	}
+
+	if current.Role == orgRoleAdmin && req.Role != orgRoleAdmin && !h.hasOtherAdmin(c, org.ID) {
+		return
+	}
+
+	member, err := h.q.UpdateOrgMemberRole(c, db.UpdateOrgMemberRoleParams{
+		OrgID:  org.ID,
+		UserID: memberID,
+		Role:   req.Role,
+	})
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	auditSubject(c, h.q, uuid.NullUUID{UUID: callerID, Valid: true}, memberID, auditOrgMemberUpdated, org.ID.String(), gin.H{
+		"from_role": current.Role,
+		"role":      req.Role,
+	})
+
+	c.JSON(200, member)
+}
+
+// RemoveMember lets admins remove anyone and any member leave on their own.
+func (h *OrgHandler) RemoveMember(c *gin.Context) {
+	memberID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		respondError(c, 400, "invalid user id")
+		return
+	}
+
+	org, callerID, ok := h.authorizeOrg(c, memberID.String() != c.GetString("userID"))
+	if !ok {
+		return
+	}
+
+	current, err := h.q.GetOrgMember(c, db.GetOrgMemberParams{
+		OrgID:  org.ID,
+		UserID: memberID,
+	})
+	if err != nil {
+		respondError(c, 404, "member not found")
+		return
+	}
+
+	if current.Role == orgRoleAdmin && !h.hasOtherAdmin(c, org.ID) {
+		return
+	}
+
+	tx, err := h.conn.BeginTx(c, nil)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := h.q.WithTx(tx)
+
+	if _, err := qtx.RemoveOrgMember(c, db.RemoveOrgMemberParams{
+		OrgID:  org.ID,
+		UserID: memberID,
+	}); err != nil {
+		serverError(c, err)
+		return
+	}
+
+	// access to the organization's instances goes with the membership
+	if err := qtx.RemoveOrgInstanceMemberships(c, db.RemoveOrgInstanceMembershipsParams{
+		OrgID:  uuid.NullUUID{UUID: org.ID, Valid: true},
+		UserID: memberID,
+	}); err != nil {
+		serverError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		serverError(c, err)
+		return
+	}
+	auditSubject(c, h.q, uuid.NullUUID{UUID: callerID, Valid: true}, memberID, auditOrgMemberRemoved, org.ID.String(), gin.H{"role": current.Role})
+
+	c.JSON(200, gin.H{"ok": true})
+}
+
+func (h *OrgHandler) ListInstances(c *gin.Context) {
+	org, _, ok := h.authorizeOrg(c, true)
+	if !ok {
+		return
+	}
+
+	instances, err := h.q.ListOrgInstances(c, uuid.NullUUID{UUID: org.ID, Valid: true})
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	c.JSON(200, instances)
+}
+
+// SwitchOrg moves the caller's session to another organization, or to their
+// personal account when org_id is empty, and issues a token for it.
+func (h *OrgHandler) SwitchOrg(c *gin.Context) {
+	var req struct {
+		OrgID string `json:"org_id"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	userUUID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		respondError(c, 401, "unauthorized")
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.GetString("sessionID"))
+	if err != nil {
+		respondError(c, 401, "unauthorized")
+		return
+	}
+
+	var orgID uuid.NullUUID
+	if req.OrgID != "" {
+		id, err := uuid.Parse(req.OrgID)
+		if err != nil {
+			respondError(c, 400, "invalid organization id")
+			return
+		}
+
+		if _, err := h.q.GetOrgMember(c, db.GetOrgMemberParams{
+			OrgID:  id,
+			UserID: userUUID,
+		}); err != nil {
+			respondError(c, 403, "not a member of this organization")
+			return
+		}
+
+		orgID = uuid.NullUUID{UUID: id, Valid: true}
+
+		if err := checkOrgMFA(c, h.q, id); errors.Is(err, errMFARequired) {
+			respondMFARequired(c)
+			return
+		} else if err != nil {
+			serverError(c, err)
+			return
+		}
+	}
+
+	// refreshed tokens pick the organization up from the session
+	if err := h.q.SetSessionOrg(c, db.SetSessionOrgParams{
+		ID:    sessionID,
+		OrgID: orgID,
+	}); err != nil {
+		serverError(c, err)
+		return
+	}
+	audit(c, h.q, uuid.NullUUID{UUID: userUUID, Valid: true}, auditOrgSwitched, req.OrgID, nil)
+
+	token, err := util.GenerateJWT(userUUID.String(), sessionID.String(), req.OrgID, c.GetString("role"))
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{"token": token})
+}
+
+// hasOtherAdmin guards against leaving an organization without an admin.
+func (h *OrgHandler) hasOtherAdmin(c *gin.Context, orgID uuid.UUID) bool {
+	admins, err := h.q.CountOrgAdmins(c, orgID)
+	if err != nil {
+		serverError(c, err)
+		return false
+	}
+	if admins < 2 {
+		respondError(c, 409, "organization must keep at least one admin")
+		return false
+	}
+	return true
+}
+
+// sessionOrg returns the organization the caller's token is scoped to, after
+// confirming they still belong to it. Personal sessions return a null ID.
+func sessionOrg(c *gin.Context, q *db.Queries, userID uuid.UUID) (uuid.NullUUID, bool) {
+	orgIDStr := c.GetString("orgID")
+	if orgIDStr == "" {
+		return uuid.NullUUID{}, true
+	}
+
+	orgID, err := uuid.Parse(orgIDStr)
+	if err != nil {
+		respondError(c, 401, "unauthorized")
+		return uuid.NullUUID{}, false
+	}
+
+	if _, err := q.GetOrgMember(c, db.GetOrgMemberParams{
+		OrgID:  orgID,
+		UserID: userID,
+	}); err != nil {
+		respondError(c, 403, "not a member of this organization")
+		return uuid.NullUUID{}, false
+	}
+
+	// the organization may have started requiring MFA since the token was
+	// issued
+	if err := checkOrgMFA(c, q, orgID); errors.Is(err, errMFARequired) {
+		respondMFARequired(c)
+		return uuid.NullUUID{}, false
+	} else if err != nil {
+		serverError(c, err)
+		return uuid.NullUUID{}, false
+	}
+
+	return uuid.NullUUID{UUID: orgID, Valid: true}, true
+}
+
+// errOrgQuotaReached is returned by createOwnedInstance when the
+// organization already has as many instances as its quota allows.
+var errOrgQuotaReached = errors.New("organization instance quota reached")
+
+// checkOrgQuota enforces the organization's shared instance limits before
+// creating (running=false) or starting (running=true) an org-owned instance.
+func checkOrgQuota(c *gin.Context, q *db.Queries, orgID uuid.UUID, running bool) bool {
+	org, err := q.GetOrganization(c, orgID)
+	if err != nil {
+		serverError(c, err)
+		return false
+	}
+
+	full, err := orgQuotaReached(c, q, org, running)
+	if err != nil {
+		serverError(c, err)
+		return false
+	}
+
+	if full {
+		respondError(c, 409, errOrgQuotaReached.Error())
+		return false
+	}
+
+	return true
+}
+
+// orgQuotaReached reports whether org has no room for another instance, or
+// for another running one when running is set.
+func orgQuotaReached(ctx context.Context, q *db.Queries, org db.Organizations, running bool) (bool, error) {
+	limit := org.MaxInstances
+	count := q.CountOrgInstances
+	if running {
+		limit = org.MaxRunningInstances
+		count = q.CountOrgRunningInstances
+	}
+
+	if !limit.Valid {
+		return false, nil
+	}
+
+	n, err := count(ctx, uuid.NullUUID{UUID: org.ID, Valid: true})
+	if err != nil {
+		return false, err
+	}
+
+	return n >= int64(limit.Int32), nil
+}
+
+func nullInt32(v *int32) sql.NullInt32 {
+	if v == nil {
+		return sql.NullInt32{}
+	}
+	return sql.NullInt32{Int32: *v, Valid: true}
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	db "example.com/m/v2/db/sqlc"
+)
+
+func TestAddMemberDoesNotChangeRoles(t *testing.T) {
+	conn, q := testDB(t)
+	ctx := context.Background()
+	h := NewOrgHandler(conn, q)
+
+	admin := testUser(t, q)
+	member := testUser(t, q)
+	newcomer := testUser(t, q)
+
+	org, err := q.CreateOrganization(ctx, "test org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, arg := range []db.AddOrgMemberParams{
+		{OrgID: org.ID, UserID: admin.ID, Role: orgRoleAdmin},
+		{OrgID: org.ID, UserID: member.ID, Role: orgRoleMember},
+	} {
+		if _, err := q.AddOrgMember(ctx, arg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sess := testSession(t, q, admin, false)
+
+	tests := []struct {
+		name     string
+		user     db.Users
+		role     string
+		status   int
+		wantRole string
+	}{
+		// the only admin demoting themselves would leave the org without one
+		{"existing admin", admin, orgRoleMember, 409, orgRoleAdmin},
+		{"existing member", member, orgRoleAdmin, 409, orgRoleMember},
+		{"new member", newcomer, orgRoleMember, 201, orgRoleMember},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(t, "POST", "/orgs/:id/members", "/orgs/"+org.ID.String()+"/members",
+				gin.H{"email": tt.user.Email, "role": tt.role}, sess, h.AddMember)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+
+			m, err := q.GetOrgMember(ctx, db.GetOrgMemberParams{OrgID: org.ID, UserID: tt.user.ID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Role != tt.wantRole {
+				t.Errorf("role = %s, want %s", m.Role, tt.wantRole)
+			}
+		})
+	}
+}
+
+func TestConcurrentCreatesRespectOrgQuota(t *testing.T) {
+	conn, q := testDB(t)
+	ctx := context.Background()
+	h := &InstanceHandler{conn: conn, q: q}
+
+	u := testUser(t, q)
+	org, err := q.CreateOrganization(ctx, "test org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const quota = 2
+	if _, err := q.UpdateOrganizationQuota(ctx, db.UpdateOrganizationQuotaParams{
+		ID:           org.ID,
+		MaxInstances: sql.NullInt32{Int32: quota, Valid: true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	const creates = 8
+	var wg sync.WaitGroup
+	errs := make([]error, creates)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("POST", "/instances", nil)
+			_, errs[i] = h.createOwnedInstance(c, db.CreateInstanceParams{
+				ID:       uuid.New(),
+				UserID:   u.ID,
+				Type:     "vscode",
+				EfsPath:  "/tmp/" + uuid.NewString(),
+				TtlHours: 1,
+				OrgID:    uuid.NullUUID{UUID: org.ID, Valid: true},
+			})
+		}()
+	}
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, errOrgQuotaReached):
+			t.Errorf("create: %v", err)
+		}
+	}
+	if created != quota {
+		t.Errorf("created %d instances, want %d", created, quota)
+	}
+
+	n, err := q.CountOrgInstances(ctx, uuid.NullUUID{UUID: org.ID, Valid: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != quota {
+		t.Errorf("org has %d instances, want %d", n, quota)
+	}
+}
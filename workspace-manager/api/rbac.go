@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	db "example.com/m/v2/db/sqlc"
+)
+
+const (
+	permOrgsCreate = "orgs:create"
+
+	// rbacRefresh bounds how long a role_permissions change takes to apply.
+	rbacRefresh = time.Minute
+)
+
+// RBAC answers whether a platform role grants a permission, using a cached
+// copy of role_permissions.
+type RBAC struct {
+	q *db.Queries
+
+	mu       sync.RWMutex
+	perms    map[string]map[string]bool
+	loadedAt time.Time
+}
+
+func NewRBAC(q *db.Queries) *RBAC {
+	return &RBAC{q: q}
+}
+
+func (r *RBAC) can(ctx context.Context, role, perm string) (bool, error) {
+	r.mu.RLock()
+	perms, fresh := r.perms, time.Since(r.loadedAt) < rbacRefresh
+	r.mu.RUnlock()
+
+	if !fresh {
+		rows, err := r.q.ListRolePermissions(ctx)
+		if err != nil {
+			return false, err
+		}
+
+		perms = map[string]map[string]bool{}
+		for _, row := range rows {
+			if perms[row.Role] == nil {
+				perms[row.Role] = map[string]bool{}
+			}
+			perms[row.Role][row.Permission] = true
+		}
+
+		r.mu.Lock()
+		r.perms, r.loadedAt = perms, time.Now()
+		r.mu.Unlock()
+	}
+
+	return perms[role][perm], nil
+}
+
+// Require aborts unless the session's role grants perm. It must run after
+// JWTMiddleware.
+func (r *RBAC) Require(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r.check(c, perm)
+	}
+}
+
+// RequireResource checks resource:read for safe methods and resource:write
+// for everything else.
+func (r *RBAC) RequireResource(resource string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			r.check(c, resource+":read")
+		default:
+			r.check(c, resource+":write")
+		}
+	}
+}
+
+func (r *RBAC) check(c *gin.Context, perm string) {
+	ok, err := r.can(c, c.GetString("role"), perm)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	if !ok {
+		respondError(c, 403, "missing permission "+perm)
+		return
+	}
+	if !tokenAllows(c, perm) {
+		respondError(c, 403, "token lacks scope "+perm)
+		return
+	}
+	c.Next()
+}
@@ -1,28 +1,190 @@
 package api
 
 import (
+	"database/sql"
+	"log"
+
 	"github.com/gin-gonic/gin"
 	db "example.com/m/v2/db/sqlc"
+	"example.com/m/v2/internal/docker"
+	"example.com/m/v2/internal/events"
+	"example.com/m/v2/internal/mailer"
+	"example.com/m/v2/util"
 )
 
-func SetupRouter(q *db.Queries) *gin.Engine {
-	r := gin.Default()
+func SetupRouter(conn *sql.DB, q *db.Queries, cfg *util.Config, keys *util.KeyRing, mail *mailer.Background, health *Health, broker *events.Broker) *gin.Engine {
+	r := gin.New()
+	// handlers pass c as their context; this makes it carry the request's
+	// span, so queries and runtime calls nest under it
+	r.ContextWithFallback = true
+
+	r.Use(requestMetrics())
+	r.Use(traceRequests()...)
+	r.Use(requestLog(), recoverPanics())
+
+	// per-IP login throttling relies on ClientIP, so only believe
+	// X-Forwarded-For from our own proxies
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("invalid TRUSTED_PROXIES: %v", err)
+	}
+
+	sandboxes, err := docker.NewAWSService(docker.AWSConfig{
+		Region:            cfg.AWSRegion,
+		AccountID:         cfg.AWSAccountID,
+		BoundaryPolicyARN: cfg.AWSBoundaryPolicyARN,
+	})
+	if err != nil {
+		log.Fatalf("cannot configure AWS: %v", err)
+	}
+
+	r.GET("/healthz", health.Live)
+	r.GET("/readyz", health.Ready)
+	r.GET("/workerz", health.Workers)
 
-	
-	r.POST("/signup", SignupHandler(q))
+	accounts := NewAccountHandler(conn, q, mail, cfg)
+
+	r.POST("/signup", SignupHandler(q, accounts))
 	r.POST("/login", LoginHandler(q))
 
+	mh := NewMFAHandler(conn, q)
+	r.POST("/login/mfa", mh.LoginMFA)
+
+	r.POST("/token/refresh", RefreshHandler(q))
+	r.GET("/.well-known/jwks.json", JWKSHandler(keys))
+
+	r.POST("/email/verify", accounts.VerifyEmail)
+	r.POST("/password/forgot", accounts.ForgotPassword)
+	r.POST("/password/reset", accounts.ResetPassword)
+
+	if cfg.OIDCIssuer != "" {
+		sso := NewOIDCHandler(conn, q, cfg)
+		r.GET("/auth/oidc/login", sso.Login)
+		r.GET("/auth/oidc/callback", sso.Callback)
+	}
+
+	// members authenticate with their JWT, everyone else with a share link
+	r.Any("/workspaces/:id/*path", WorkspaceProxy(cfg, q))
+
 	auth := r.Group("/")
-	auth.Use(JWTMiddleware())
+	auth.Use(JWTMiddleware(q))
+
+	rbac := NewRBAC(q)
+
+	// credentials are only managed, and the profile and audit history only
+	// read, from a login session, never an API token
+	account := auth.Group("")
+	account.Use(RequireSession())
+
+	account.POST("/logout", LogoutHandler(q))
+	account.POST("/email/verify/resend", accounts.ResendVerification)
+
+	account.GET("/mfa", mh.Status)
+	account.POST("/mfa/totp/enroll", mh.Enroll)
+	account.POST("/mfa/totp/confirm", mh.Confirm)
+	account.POST("/mfa/totp/disable", mh.Disable)
+	account.POST("/mfa/recovery-codes", mh.RegenerateRecoveryCodes)
+
+	me := NewMeHandler(conn, q, cfg, sandboxes)
+	account.GET("/me", me.Get)
+	account.PATCH("/me", me.Update)
+	account.POST("/me/password", me.ChangePassword)
+	account.DELETE("/me", me.Delete)
+
+	account.POST("/me/export", me.RequestExport)
+	account.GET("/me/exports", me.ListExports)
+	account.GET("/me/exports/:id", me.GetExport)
+
+	// the signed link is the only credential
+	r.GET("/exports/:id/download", me.DownloadExport)
+
+	audits := NewAuditHandler(q)
+	account.GET("/me/audit-events", audits.ListMine)
+	account.GET("/me/audit-events/export", audits.ExportMine)
+
+	th := NewTokenHandler(q, rbac)
+	account.GET("/tokens", th.ListTokens)
+	account.POST("/tokens", th.CreateToken)
+	account.DELETE("/tokens/:id", th.RevokeToken)
+
+	ih := NewInstanceHandler(conn, q, sandboxes, broker)
+
+	instances := auth.Group("/instances")
+	instances.Use(rbac.RequireResource("instances"))
+
+	instances.POST("", ih.CreateInstance)
+	instances.GET("", ih.ListInstances)
+	instances.GET("/events", ih.Events)
+
+	instances.POST("/:id/start", ih.StartInstance)
+	instances.POST("/:id/stop", ih.StopInstance)
+	instances.POST("/:id/heartbeat", ih.Heartbeat)
+
+	instances.GET("/:id/members", ih.ListMembers)
+	instances.POST("/:id/members", ih.InviteMember)
+	instances.PATCH("/:id/members/:userId", ih.UpdateMember)
+	instances.DELETE("/:id/members/:userId", ih.RemoveMember)
+
+	instances.POST("/:id/share", ih.CreateShare)
+	instances.GET("/:id/shares", ih.ListShares)
+	instances.DELETE("/:id/shares/:shareId", ih.RevokeShare)
+	instances.GET("/:id/shares/:shareId/accesses", ih.ListShareAccesses)
+
+	oh := NewOrgHandler(conn, q)
+
+	orgs := auth.Group("/orgs")
+	orgs.Use(rbac.RequireResource("orgs"))
+
+	orgs.POST("", rbac.Require(permOrgsCreate), oh.CreateOrg)
+	orgs.GET("", oh.ListOrgs)
+	orgs.POST("/switch", oh.SwitchOrg)
+	orgs.GET("/:id", oh.GetOrg)
+	orgs.PATCH("/:id/quota", oh.UpdateQuota)
+	orgs.PUT("/:id/mfa", oh.SetRequireMFA)
+	orgs.GET("/:id/instances", oh.ListInstances)
+
+	orgs.GET("/:id/members", oh.ListMembers)
+	orgs.POST("/:id/members", oh.AddMember)
+	orgs.PATCH("/:id/members/:userId", oh.UpdateMember)
+	orgs.DELETE("/:id/members/:userId", oh.RemoveMember)
+
+	wh := NewWebhookHandler(q, cfg)
+
+	webhooks := auth.Group("/webhooks")
+	webhooks.Use(rbac.RequireResource("webhooks"))
+
+	webhooks.POST("", wh.CreateWebhook)
+	webhooks.GET("", wh.ListWebhooks)
+	webhooks.GET("/:id", wh.GetWebhook)
+	webhooks.PATCH("/:id", wh.UpdateWebhook)
+	webhooks.DELETE("/:id", wh.DeleteWebhook)
+	webhooks.POST("/:id/secret", wh.RotateSecret)
+	webhooks.GET("/:id/deliveries", wh.ListDeliveries)
+	webhooks.POST("/:id/deliveries/:deliveryId/redeliver", wh.Redeliver)
+
+	ah := NewAdminHandler(q, sandboxes)
+
+	admin := auth.Group("/admin")
+	admin.Use(rbac.RequireResource("admin"))
+
+	admin.GET("/instances", ah.ListInstances)
+	admin.POST("/instances/:id/stop", ah.StopInstance)
+	admin.DELETE("/instances/:id", ah.DeleteInstance)
+
+	admin.GET("/users", ah.ListUsers)
+	admin.POST("/users/:id/disable", ah.DisableUser)
+	admin.POST("/users/:id/enable", ah.EnableUser)
+	admin.PUT("/users/:id/role", ah.SetUserRole)
 
-	ih := NewInstanceHandler(q)
+	admin.GET("/invites", ah.ListInvites)
+	admin.POST("/invites", ah.CreateInvite)
+	admin.DELETE("/invites/:id", ah.RevokeInvite)
+	admin.GET("/roles", ah.ListRoles)
 
-	auth.POST("/instances", ih.CreateInstance)
-	auth.GET("/instances", ih.ListInstances)
+	admin.GET("/audit-events", audits.ListAll)
+	admin.GET("/audit-events/export", audits.ExportAll)
 
-	auth.POST("/instances/:id/start", ih.StartInstance)
-	auth.POST("/instances/:id/stop", ih.StopInstance)
-	auth.POST("/instances/:id/heartbeat", ih.Heartbeat)
+	admin.GET("/host", ah.HostUsage)
+	admin.POST("/reconcile", ah.Reconcile)
 
 	return r
 }
@@ -0,0 +1,203 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	db "example.com/m/v2/db/sqlc"
+	"example.com/m/v2/util"
+)
+
+// startSession opens a login session for u and returns its first access and
+// refresh tokens. mfaVerified records whether the login passed a second
+// factor, which organizations requiring MFA check.
+func startSession(c *gin.Context, q *db.Queries, u db.Users, orgID uuid.NullUUID, mfaVerified bool) (gin.H, error) {
+	sess, err := q.CreateSession(c, db.CreateSessionParams{
+		UserID:      u.ID,
+		OrgID:       orgID,
+		MfaVerified: mfaVerified,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	audit(c, q, uuid.NullUUID{UUID: u.ID, Valid: true}, auditLoginSucceeded, sess.ID.String(), gin.H{
+		"mfa":    mfaVerified,
+		"org_id": orgID,
+	})
+	return issueTokens(c, q, sess, u.Role)
+}
+
+// issueTokens mints a new refresh token for sess and an access token bound
+// to it.
+func issueTokens(c *gin.Context, q *db.Queries, sess db.Sessions, role string) (gin.H, error) {
+	refresh, hash, err := util.NewToken()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := q.CreateRefreshToken(c, db.CreateRefreshTokenParams{
+		TokenHash: hash,
+		SessionID: sess.ID,
+		ExpiresAt: time.Now().Add(util.RefreshTokenTTL),
+	}); err != nil {
+		return nil, err
+	}
+
+	orgID := ""
+	if sess.OrgID.Valid {
+		orgID = sess.OrgID.UUID.String()
+	}
+
+	access, err := util.GenerateJWT(sess.UserID.String(), sess.ID.String(), orgID, role)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"token":         access,
+		"refresh_token": refresh,
+		"expires_in":    int(util.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+var errMFARequired = errors.New("organization requires multi-factor authentication")
+
+// checkOrgMFA returns errMFARequired when the organization requires MFA and
+// the request's credential did not pass it: neither its login session nor,
+// for an API token, the session the token was created in.
+func checkOrgMFA(c *gin.Context, q *db.Queries, orgID uuid.UUID) error {
+	if c.GetBool("mfaVerified") {
+		return nil
+	}
+	required, err := orgRequiresMFA(c, q, uuid.NullUUID{UUID: orgID, Valid: true})
+	if err != nil {
+		return err
+	}
+	if required {
+		return errMFARequired
+	}
+	return nil
+}
+
+func respondMFARequired(c *gin.Context) {
+	respondErrorCode(c, 403, codeMFARequired, "this organization requires multi-factor authentication; log in again with it", nil)
+}
+
+// RefreshHandler exchanges a refresh token for a new access/refresh pair.
+// Each refresh token works once; presenting one again means it leaked, so the
+// whole session is revoked.
+func RefreshHandler(q *db.Queries) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil || req.RefreshToken == "" {
+			respondError(c, 400, "refresh_token is required")
+			return
+		}
+
+		hash := util.HashToken(req.RefreshToken)
+
+		rt, err := q.UseRefreshToken(c, hash)
+		if errors.Is(err, sql.ErrNoRows) {
+			if used, err := q.GetRefreshToken(c, hash); err == nil {
+				if err := q.RevokeSession(c, used.SessionID); err != nil {
+					serverError(c, err)
+					return
+				}
+				audit(c, q, uuid.NullUUID{}, auditRefreshReused, used.SessionID.String(), nil)
+				respondError(c, 401, "refresh token reused, session revoked")
+				return
+			}
+			respondError(c, 401, "invalid refresh token")
+			return
+		}
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+
+		if time.Now().After(rt.ExpiresAt) {
+			respondError(c, 401, "refresh token expired")
+			return
+		}
+
+		sess, err := q.GetSession(c, rt.SessionID)
+		if err != nil || sess.RevokedAt.Valid {
+			respondError(c, 401, "session revoked")
+			return
+		}
+
+		u, err := q.GetUserByID(c, sess.UserID)
+		if err != nil || u.DisabledAt.Valid {
+			respondError(c, 401, "account disabled")
+			return
+		}
+
+		// fall back to personal use if they have left the organization or it
+		// has started requiring MFA since they logged in
+		if sess.OrgID.Valid {
+			_, err := q.GetOrgMember(c, db.GetOrgMemberParams{
+				OrgID:  sess.OrgID.UUID,
+				UserID: u.ID,
+			})
+			if err == nil && !sess.MfaVerified {
+				var required bool
+				required, err = orgRequiresMFA(c, q, sess.OrgID)
+				if err == nil && required {
+					err = errMFARequired
+				}
+			}
+			if err != nil {
+				sess.OrgID = uuid.NullUUID{}
+				if err := q.SetSessionOrg(c, db.SetSessionOrgParams{ID: sess.ID}); err != nil {
+					serverError(c, err)
+					return
+				}
+			}
+		}
+
+		tokens, err := issueTokens(c, q, sess, u.Role)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+
+		c.JSON(200, tokens)
+	}
+}
+
+// LogoutHandler revokes the caller's session, which invalidates its access
+// and refresh tokens.
+func LogoutHandler(q *db.Queries) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sessionID, err := uuid.Parse(c.GetString("sessionID"))
+		if err != nil {
+			respondError(c, 401, "unauthorized")
+			return
+		}
+
+		if err := q.RevokeSession(c, sessionID); err != nil {
+			serverError(c, err)
+			return
+		}
+		audit(c, q, auditActor(c), auditLogout, sessionID.String(), nil)
+
+		c.JSON(200, gin.H{"ok": true})
+	}
+}
+
+// JWKSHandler publishes the public signing keys so other services, such as
+// workspace sidecars, can verify access tokens themselves.
+func JWKSHandler(keys *util.KeyRing) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(200, gin.H{"keys": keys.JWKS()})
+	}
+}
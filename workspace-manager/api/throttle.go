@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	db "example.com/m/v2/db/sqlc"
+)
+
+// Failed logins are counted per client IP and per account. Past the free
+// attempts each further failure doubles the lockout, up to maxLockout.
+// Counters reset after an hour without failures (see RecordLoginFailure).
+const (
+	accountFreeAttempts = 5
+	ipFreeAttempts      = 20
+
+	baseLockout = 30 * time.Second
+	maxLockout  = time.Hour
+)
+
+type loginThrottle struct {
+	key  string
+	free int32
+}
+
+func loginThrottles(ip, email string) []loginThrottle {
+	return []loginThrottle{
+		{key: "ip:" + ip, free: ipFreeAttempts},
+		{key: "account:" + strings.ToLower(strings.TrimSpace(email)), free: accountFreeAttempts},
+	}
+}
+
+// lockedFor is how much longer the key is locked out, or zero.
+func (t loginThrottle) lockedFor(row db.LoginThrottles, now time.Time) time.Duration {
+	over := row.Failures - t.free
+	if over < 0 {
+		return 0
+	}
+
+	// the shift is bounded so it cannot overflow
+	lockout := maxLockout
+	if over < 10 {
+		lockout = min(baseLockout<<over, maxLockout)
+	}
+
+	if left := row.LastFailureAt.Add(lockout).Sub(now); left > 0 {
+		return left
+	}
+	return 0
+}
+
+// loginLockout returns the longest active lockout across the IP and account.
+func loginLockout(ctx context.Context, q *db.Queries, ip, email string) (time.Duration, error) {
+	var longest time.Duration
+	now := time.Now()
+
+	for _, t := range loginThrottles(ip, email) {
+		row, err := q.GetLoginThrottle(ctx, t.key)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if d := t.lockedFor(row, now); d > longest {
+			longest = d
+		}
+	}
+
+	return longest, nil
+}
+
+// respondLockedOut tells the client how long to wait before trying again.
+func respondLockedOut(c *gin.Context, locked time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(locked.Seconds()))))
+	respondError(c, 429, "too many failed attempts, try again later")
+}
+
+func recordLoginFailure(ctx context.Context, q *db.Queries, ip, email string) error {
+	for _, t := range loginThrottles(ip, email) {
+		if _, err := q.RecordLoginFailure(ctx, t.key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clearAccountThrottle forgets an account's failures once a login has fully
+// succeeded, second factor included. The IP counter is left alone so one valid account cannot be used to reset
+// guessing against others.
+func clearAccountThrottle(ctx context.Context, q *db.Queries, email string) error {
+	return q.ClearLoginThrottle(ctx, loginThrottles("", email)[1].key)
+}
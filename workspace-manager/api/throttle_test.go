@@ -0,0 +1,72 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	db "example.com/m/v2/db/sqlc"
+)
+
+func TestLoginThrottleLockedFor(t *testing.T) {
+	now := time.Now()
+	account := loginThrottle{key: "account:a@example.com", free: accountFreeAttempts}
+
+	tests := []struct {
+		name     string
+		failures int32
+		since    time.Duration
+		want     time.Duration
+	}{
+		{"free attempts", accountFreeAttempts - 1, 0, 0},
+		{"first lockout", accountFreeAttempts, 0, baseLockout},
+		{"doubles", accountFreeAttempts + 1, 0, 2 * baseLockout},
+		{"doubles again", accountFreeAttempts + 2, 0, 4 * baseLockout},
+		{"capped", accountFreeAttempts + 7, 0, maxLockout},
+		{"no overflow", accountFreeAttempts + 100, 0, maxLockout},
+		{"partly served", accountFreeAttempts + 1, 10 * time.Second, 2*baseLockout - 10*time.Second},
+		{"served", accountFreeAttempts + 1, 2 * baseLockout, 0},
+		{"long served", accountFreeAttempts + 100, 2 * maxLockout, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := db.LoginThrottles{
+				Key:           account.key,
+				Failures:      tt.failures,
+				LastFailureAt: now.Add(-tt.since),
+			}
+			if got := account.lockedFor(row, now); got != tt.want {
+				t.Errorf("lockedFor(%d failures, %v ago) = %v, want %v", tt.failures, tt.since, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginThrottlesKeys(t *testing.T) {
+	tests := []struct {
+		ip, email string
+		want      []loginThrottle
+	}{
+		{"10.0.0.1", "a@example.com", []loginThrottle{
+			{key: "ip:10.0.0.1", free: ipFreeAttempts},
+			{key: "account:a@example.com", free: accountFreeAttempts},
+		}},
+		// one account however its email is typed
+		{"10.0.0.1", "  A@Example.COM ", []loginThrottle{
+			{key: "ip:10.0.0.1", free: ipFreeAttempts},
+			{key: "account:a@example.com", free: accountFreeAttempts},
+		}},
+	}
+
+	for _, tt := range tests {
+		got := loginThrottles(tt.ip, tt.email)
+		if len(got) != len(tt.want) {
+			t.Fatalf("loginThrottles(%q, %q) = %v, want %v", tt.ip, tt.email, got, tt.want)
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("loginThrottles(%q, %q)[%d] = %v, want %v", tt.ip, tt.email, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package api
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	db "example.com/m/v2/db/sqlc"
+	"example.com/m/v2/internal/logging"
+	"example.com/m/v2/util"
+)
+
+const (
+	// apiTokenPrefix tells personal access tokens apart from JWTs, and makes
+	// leaked tokens easy to find with secret scanners.
+	apiTokenPrefix = "wmp_"
+
+	defaultTokenDays = 30
+	maxTokenDays     = 365
+)
+
+type apiTokenResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	OrgID      *uuid.UUID `json:"org_id"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func newAPITokenResponse(t db.ApiTokens) apiTokenResponse {
+	resp := apiTokenResponse{
+		ID:        t.ID,
+		Name:      t.Name,
+		Prefix:    t.Prefix,
+		Scopes:    strings.Fields(t.Scopes),
+		ExpiresAt: t.ExpiresAt,
+		CreatedAt: t.CreatedAt,
+	}
+	if t.OrgID.Valid {
+		resp.OrgID = &t.OrgID.UUID
+	}
+	if t.LastUsedAt.Valid {
+		resp.LastUsedAt = &t.LastUsedAt.Time
+	}
+	return resp
+}
+
+// TokenHandler lets users manage their personal access tokens.
+type TokenHandler struct {
+	q    *db.Queries
+	rbac *RBAC
+}
+
+func NewTokenHandler(q *db.Queries, rbac *RBAC) *TokenHandler {
+	return &TokenHandler{q: q, rbac: rbac}
+}
+
+// CreateToken issues a token acting in the caller's current organization.
+// Scopes can only narrow what the caller's role already grants. The token is
+// only returned here.
+func (h *TokenHandler) CreateToken(c *gin.Context) {
+	var req struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		respondError(c, 400, "name must be 1-100 characters")
+		return
+	}
+
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = defaultTokenDays
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > maxTokenDays {
+		respondError(c, 400, "expires_in_days must be between 1 and 365")
+		return
+	}
+
+	if len(req.Scopes) == 0 {
+		respondError(c, 400, "at least one scope is required")
+		return
+	}
+
+	role := c.GetString("role")
+	for _, s := range req.Scopes {
+		ok, err := h.rbac.can(c, role, s)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+		if !ok {
+			respondError(c, 400, "scope "+s+" is not granted to your role")
+			return
+		}
+	}
+	slices.Sort(req.Scopes)
+	req.Scopes = slices.Compact(req.Scopes)
+
+	userID, ok := callerID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := sessionOrg(c, h.q, userID)
+	if !ok {
+		return
+	}
+
+	secret, _, err := util.NewToken()
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	token := apiTokenPrefix + secret
+
+	t, err := h.q.CreateAPIToken(c, db.CreateAPITokenParams{
+		UserID:    userID,
+		OrgID:     orgID,
+		Name:      req.Name,
+		TokenHash: util.HashToken(token),
+		Prefix:    token[:len(apiTokenPrefix)+6],
+		Scopes:    strings.Join(req.Scopes, " "),
+		ExpiresAt: time.Now().AddDate(0, 0, req.ExpiresInDays),
+		// the token passes MFA checks only if its session did
+		MfaVerified: c.GetBool("mfaVerified"),
+	})
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	audit(c, h.q, uuid.NullUUID{UUID: userID, Valid: true}, auditTokenCreated, t.ID.String(), gin.H{
+		"name":       t.Name,
+		"scopes":     req.Scopes,
+		"expires_at": t.ExpiresAt,
+	})
+
+	c.JSON(201, gin.H{
+		"token":     token,
+		"api_token": newAPITokenResponse(t),
+	})
+}
+
+func (h *TokenHandler) ListTokens(c *gin.Context) {
+	userID, ok := callerID(c)
+	if !ok {
+		return
+	}
+
+	tokens, err := h.q.ListUserAPITokens(c, userID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	resp := make([]apiTokenResponse, 0, len(tokens))
+	for _, t := range tokens {
+		resp = append(resp, newAPITokenResponse(t))
+	}
+
+	c.JSON(200, resp)
+}
+
+func (h *TokenHandler) RevokeToken(c *gin.Context) {
+	userID, ok := callerID(c)
+	if !ok {
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respondError(c, 400, "invalid token id")
+		return
+	}
+
+	n, err := h.q.RevokeAPIToken(c, db.RevokeAPITokenParams{
+		ID:     id,
+		UserID: userID,
+	})
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	if n == 0 {
+		respondError(c, 404, "token not found")
+		return
+	}
+	audit(c, h.q, uuid.NullUUID{UUID: userID, Valid: true}, auditTokenRevoked, id.String(), nil)
+
+	c.JSON(200, gin.H{"ok": true})
+}
+
+// apiTokenAuth is JWTMiddleware's path for personal access tokens.
+func apiTokenAuth(c *gin.Context, q *db.Queries, token string) {
+	t, err := q.GetAPITokenByHash(c, util.HashToken(token))
+	if err != nil || t.RevokedAt.Valid || time.Now().After(t.ExpiresAt) {
+		respondError(c, 401, "invalid api token")
+		return
+	}
+
+	u, err := q.GetUserByID(c, t.UserID)
+	if err != nil || u.DisabledAt.Valid {
+		respondError(c, 401, "account disabled")
+		return
+	}
+
+	orgID := ""
+	if t.OrgID.Valid {
+		if _, err := q.GetOrgMember(c, db.GetOrgMemberParams{
+			OrgID:  t.OrgID.UUID,
+			UserID: t.UserID,
+		}); err != nil {
+			respondError(c, 401, "no longer a member of the token's organization")
+			return
+		}
+		orgID = t.OrgID.UUID.String()
+
+		// tokens created before the organization started requiring MFA, or
+		// from a session without it, stop working there
+		required, err := orgRequiresMFA(c, q, t.OrgID)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+		if required && !t.MfaVerified {
+			respondErrorCode(c, 401, codeMFARequired, "the token's organization requires multi-factor authentication; create a new token after logging in with it", nil)
+			return
+		}
+	}
+
+	if err := q.TouchAPIToken(c, t.ID); err != nil {
+		serverError(c, err)
+		return
+	}
+
+	// role is read live so demotions apply immediately; scopes narrow it
+	c.Set("userID", t.UserID.String())
+	c.Set("tokenID", t.ID.String())
+	c.Set("orgID", orgID)
+	c.Set("role", u.Role)
+	c.Set("scopes", strings.Fields(t.Scopes))
+	c.Set("mfaVerified", t.MfaVerified)
+	logWith(c,
+		slog.String(logging.UserIDKey, t.UserID.String()),
+		slog.String("token_id", t.ID.String()),
+	)
+	c.Next()
+}
+
+// tokenAllows reports whether the credential permits perm. Login sessions
+// carry no scopes and are limited by role alone.
+func tokenAllows(c *gin.Context, perm string) bool {
+	scopes, ok := c.Get("scopes")
+	if !ok {
+		return true
+	}
+	return slices.Contains(scopes.([]string), perm)
+}
+
+// RequireSession rejects API tokens on routes that manage the account's own
+// credentials, so a leaked token cannot be used to mint more, or that expose
+// its profile and audit history.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("tokenID") != "" {
+			respondError(c, 403, "not available to api tokens")
+			return
+		}
+		c.Next()
+	}
+}
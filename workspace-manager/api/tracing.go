@@ -0,0 +1,30 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+
+	"example.com/m/v2/internal/tracing"
+)
+
+// traceRequests starts a span for every request, named after its route
+// template, and echoes the trace ID in X-Trace-Id so a user reporting an
+// error can hand it to us. Probes are left out; they would drown everything
+// else.
+func traceRequests() []gin.HandlerFunc {
+	return []gin.HandlerFunc{
+		otelgin.Middleware(tracing.ServiceName, otelgin.WithGinFilter(func(c *gin.Context) bool {
+			switch c.FullPath() {
+			case "/healthz", "/readyz":
+				return false
+			}
+			return true
+		})),
+		func(c *gin.Context) {
+			if id := tracing.TraceID(c.Request.Context()); id != "" {
+				c.Header("X-Trace-Id", id)
+			}
+			c.Next()
+		},
+	}
+}
@@ -0,0 +1,474 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	db "example.com/m/v2/db/sqlc"
+	"example.com/m/v2/internal/webhook"
+	"example.com/m/v2/util"
+)
+
+const maxWebhookURL = 2048
+
+type webhookResponse struct {
+	ID        uuid.UUID  `json:"id"`
+	UserID    *uuid.UUID `json:"user_id"`
+	OrgID     *uuid.UUID `json:"org_id"`
+	URL       string     `json:"url"`
+	Events    []string   `json:"events"`
+	Enabled   bool       `json:"enabled"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+func newWebhookResponse(w db.Webhooks) webhookResponse {
+	resp := webhookResponse{
+		ID:        w.ID,
+		URL:       w.Url,
+		Events:    strings.Fields(w.Events),
+		Enabled:   w.Enabled,
+		CreatedAt: w.CreatedAt,
+		UpdatedAt: w.UpdatedAt,
+	}
+	if w.UserID.Valid {
+		resp.UserID = &w.UserID.UUID
+	}
+	if w.OrgID.Valid {
+		resp.OrgID = &w.OrgID.UUID
+	}
+	return resp
+}
+
+type webhookDeliveryResponse struct {
+	ID             uuid.UUID       `json:"id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at"`
+	ResponseStatus *int32          `json:"response_status"`
+	Error          string          `json:"error"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+func newWebhookDeliveryResponse(d db.WebhookDeliveries) webhookDeliveryResponse {
+	resp := webhookDeliveryResponse{
+		ID:        d.ID,
+		Event:     d.Event,
+		Payload:   d.Payload,
+		Status:    d.Status,
+		Attempts:  d.Attempts,
+		Error:     d.Error,
+		CreatedAt: d.CreatedAt,
+	}
+	if d.Status == "pending" {
+		resp.NextAttemptAt = &d.NextAttemptAt
+	}
+	if d.LastAttemptAt.Valid {
+		resp.LastAttemptAt = &d.LastAttemptAt.Time
+	}
+	if d.ResponseStatus.Valid {
+		resp.ResponseStatus = &d.ResponseStatus.Int32
+	}
+	if d.DeliveredAt.Valid {
+		resp.DeliveredAt = &d.DeliveredAt.Time
+	}
+	return resp
+}
+
+// WebhookHandler lets users manage webhooks for their own instances, and
+// organization admins for the organization's.
+type WebhookHandler struct {
+	q   *db.Queries
+	cfg *util.Config
+}
+
+func NewWebhookHandler(q *db.Queries, cfg *util.Config) *WebhookHandler {
+	return &WebhookHandler{q: q, cfg: cfg}
+}
+
+// CreateWebhook registers a receiver URL. With org_id it is an organization
+// webhook, which takes an org admin. The signing secret is only returned
+// here and by RotateSecret.
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	var req struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+		OrgID  string   `json:"org_id"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if !h.checkURL(c, req.URL) {
+		return
+	}
+	events, ok := webhookEvents(c, req.Events)
+	if !ok {
+		return
+	}
+
+	userID, ok := callerID(c)
+	if !ok {
+		return
+	}
+
+	arg := db.CreateWebhookParams{
+		Url:       req.URL,
+		Events:    events,
+		CreatedBy: uuid.NullUUID{UUID: userID, Valid: true},
+	}
+	if req.OrgID == "" {
+		arg.UserID = uuid.NullUUID{UUID: userID, Valid: true}
+	} else {
+		orgID, err := uuid.Parse(req.OrgID)
+		if err != nil {
+			respondError(c, 400, "invalid organization id")
+			return
+		}
+		if !h.requireOrgAdmin(c, orgID, userID, "organization not found") {
+			return
+		}
+		arg.OrgID = uuid.NullUUID{UUID: orgID, Valid: true}
+	}
+
+	secret, _, err := util.NewToken()
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	arg.Secret = secret
+
+	w, err := h.q.CreateWebhook(c, arg)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	audit(c, h.q, uuid.NullUUID{UUID: userID, Valid: true}, auditWebhookCreated, w.ID.String(), gin.H{
+		"url":    w.Url,
+		"events": strings.Fields(w.Events),
+		"org_id": req.OrgID,
+	})
+
+	c.JSON(201, gin.H{
+		"webhook": newWebhookResponse(w),
+		"secret":  secret,
+	})
+}
+
+// ListWebhooks lists the caller's own webhooks, or with ?org_id= the
+// organization's.
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	userID, ok := callerID(c)
+	if !ok {
+		return
+	}
+
+	orgID, ok := queryUUID(c, "org_id")
+	if !ok {
+		return
+	}
+
+	var hooks []db.Webhooks
+	var err error
+	if orgID.Valid {
+		if !h.requireOrgAdmin(c, orgID.UUID, userID, "organization not found") {
+			return
+		}
+		hooks, err = h.q.ListOrgWebhooks(c, orgID)
+	} else {
+		hooks, err = h.q.ListUserWebhooks(c, uuid.NullUUID{UUID: userID, Valid: true})
+	}
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	resp := make([]webhookResponse, 0, len(hooks))
+	for _, w := range hooks {
+		resp = append(resp, newWebhookResponse(w))
+	}
+
+	c.JSON(200, resp)
+}
+
+func (h *WebhookHandler) GetWebhook(c *gin.Context) {
+	w, _, ok := h.authorizeWebhook(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(200, newWebhookResponse(w))
+}
+
+// UpdateWebhook changes the URL, the events or whether it is enabled. A
+// disabled webhook queues nothing, and what it had queued waits until it is
+// enabled again.
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	var req struct {
+		URL     *string  `json:"url"`
+		Events  []string `json:"events"`
+		Enabled *bool    `json:"enabled"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	var arg db.UpdateWebhookParams
+	if req.URL != nil {
+		if !h.checkURL(c, *req.URL) {
+			return
+		}
+		arg.Url = sql.NullString{String: *req.URL, Valid: true}
+	}
+	if req.Events != nil {
+		events, ok := webhookEvents(c, req.Events)
+		if !ok {
+			return
+		}
+		arg.Events = sql.NullString{String: events, Valid: true}
+	}
+	if req.Enabled != nil {
+		arg.Enabled = sql.NullBool{Bool: *req.Enabled, Valid: true}
+	}
+
+	w, callerID, ok := h.authorizeWebhook(c)
+	if !ok {
+		return
+	}
+	arg.ID = w.ID
+
+	w, err := h.q.UpdateWebhook(c, arg)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	audit(c, h.q, uuid.NullUUID{UUID: callerID, Valid: true}, auditWebhookUpdated, w.ID.String(), gin.H{
+		"url":     w.Url,
+		"events":  strings.Fields(w.Events),
+		"enabled": w.Enabled,
+	})
+
+	c.JSON(200, newWebhookResponse(w))
+}
+
+// RotateSecret replaces the signing secret. Deliveries sent from now on,
+// retries included, are signed with the new one.
+func (h *WebhookHandler) RotateSecret(c *gin.Context) {
+	w, callerID, ok := h.authorizeWebhook(c)
+	if !ok {
+		return
+	}
+
+	secret, _, err := util.NewToken()
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	w, err = h.q.RotateWebhookSecret(c, db.RotateWebhookSecretParams{
+		ID:     w.ID,
+		Secret: secret,
+	})
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	audit(c, h.q, uuid.NullUUID{UUID: callerID, Valid: true}, auditWebhookSecretRotated, w.ID.String(), nil)
+
+	c.JSON(200, gin.H{
+		"webhook": newWebhookResponse(w),
+		"secret":  secret,
+	})
+}
+
+// DeleteWebhook removes the webhook along with its delivery log and
+// anything still queued.
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	w, callerID, ok := h.authorizeWebhook(c)
+	if !ok {
+		return
+	}
+
+	if err := h.q.DeleteWebhook(c, w.ID); err != nil {
+		serverError(c, err)
+		return
+	}
+	audit(c, h.q, uuid.NullUUID{UUID: callerID, Valid: true}, auditWebhookDeleted, w.ID.String(), gin.H{"url": w.Url})
+
+	c.JSON(200, gin.H{"ok": true})
+}
+
+// ListDeliveries is the delivery log, newest first. ?status= narrows it to
+// pending, delivered or failed deliveries.
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	w, _, ok := h.authorizeWebhook(c)
+	if !ok {
+		return
+	}
+
+	status := queryString(c, "status")
+	if status.Valid && !slices.Contains([]string{"pending", "delivered", "failed"}, status.String) {
+		respondError(c, 400, "status must be pending, delivered or failed")
+		return
+	}
+
+	limit, offset := pagination(c)
+	deliveries, err := h.q.ListWebhookDeliveries(c, db.ListWebhookDeliveriesParams{
+		WebhookID: w.ID,
+		Status:    status,
+		Limit:     limit,
+		Offset:    offset,
+	})
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	resp := make([]webhookDeliveryResponse, 0, len(deliveries))
+	for _, d := range deliveries {
+		resp = append(resp, newWebhookDeliveryResponse(d))
+	}
+
+	c.JSON(200, resp)
+}
+
+// Redeliver queues a finished delivery again, e.g. once a receiver that
+// kept failing has been fixed. It gets a fresh set of attempts.
+func (h *WebhookHandler) Redeliver(c *gin.Context) {
+	deliveryID, err := uuid.Parse(c.Param("deliveryId"))
+	if err != nil {
+		respondError(c, 400, "invalid delivery id")
+		return
+	}
+
+	w, callerID, ok := h.authorizeWebhook(c)
+	if !ok {
+		return
+	}
+
+	d, err := h.q.RedeliverWebhookDelivery(c, db.RedeliverWebhookDeliveryParams{
+		ID:        deliveryID,
+		WebhookID: w.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(c, 404, "delivery not found or still pending")
+		return
+	}
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	// the webhook's creator sees it too when an org admin resends their
+	// deliveries
+	subject := callerID
+	if w.CreatedBy.Valid {
+		subject = w.CreatedBy.UUID
+	}
+	auditSubject(c, h.q, uuid.NullUUID{UUID: callerID, Valid: true}, subject, auditWebhookRedelivered, w.ID.String(), gin.H{
+		"delivery_id": d.ID,
+		"event":       d.Event,
+	})
+
+	c.JSON(200, newWebhookDeliveryResponse(d))
+}
+
+// authorizeWebhook loads the webhook named in the path. Personal webhooks
+// are visible to their user only, organization webhooks to the org's
+// admins.
+func (h *WebhookHandler) authorizeWebhook(c *gin.Context) (db.Webhooks, uuid.UUID, bool) {
+	userID, ok := callerID(c)
+	if !ok {
+		return db.Webhooks{}, uuid.Nil, false
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respondError(c, 400, "invalid webhook id")
+		return db.Webhooks{}, uuid.Nil, false
+	}
+
+	w, err := h.q.GetWebhook(c, id)
+	if err != nil {
+		respondError(c, 404, "webhook not found")
+		return db.Webhooks{}, uuid.Nil, false
+	}
+
+	if w.OrgID.Valid {
+		if !h.requireOrgAdmin(c, w.OrgID.UUID, userID, "webhook not found") {
+			return db.Webhooks{}, uuid.Nil, false
+		}
+	} else if w.UserID.UUID != userID {
+		respondError(c, 404, "webhook not found")
+		return db.Webhooks{}, uuid.Nil, false
+	}
+
+	return w, userID, true
+}
+
+// requireOrgAdmin rejects callers who are not admins of orgID, answering
+// notFound to those outside the organization.
+func (h *WebhookHandler) requireOrgAdmin(c *gin.Context, orgID, userID uuid.UUID, notFound string) bool {
+	member, err := h.q.GetOrgMember(c, db.GetOrgMemberParams{
+		OrgID:  orgID,
+		UserID: userID,
+	})
+	if err != nil {
+		respondError(c, 404, notFound)
+		return false
+	}
+	if member.Role != orgRoleAdmin {
+		respondError(c, 403, "requires admin role")
+		return false
+	}
+	return true
+}
+
+// checkURL validates a receiver URL. Production requires HTTPS, so payloads
+// and their signatures are not sent in the clear.
+func (h *WebhookHandler) checkURL(c *gin.Context, raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") || len(raw) > maxWebhookURL {
+		validationFailed(c, FieldError{Field: "url", Message: "url must be an absolute http or https URL"})
+		return false
+	}
+	if h.cfg.IsProduction() && u.Scheme != "https" {
+		validationFailed(c, FieldError{Field: "url", Message: "url must use https"})
+		return false
+	}
+	return true
+}
+
+// webhookEvents validates a subscription and returns it as stored.
+func webhookEvents(c *gin.Context, events []string) (string, bool) {
+	if len(events) == 0 {
+		validationFailed(c, FieldError{Field: "events", Message: "at least one event is required"})
+		return "", false
+	}
+	for _, e := range events {
+		if !webhook.Valid(e) {
+			validationFailed(c, FieldError{Field: "events", Message: "unknown event " + e + "; expected one of " + strings.Join(webhook.Events, ", ")})
+			return "", false
+		}
+	}
+
+	events = slices.Clone(events)
+	slices.Sort(events)
+	return strings.Join(slices.Compact(events), " "), true
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+
+	db "example.com/m/v2/db/sqlc"
+)
+
+func TestRedeliverIsAudited(t *testing.T) {
+	_, q := testDB(t)
+	ctx := context.Background()
+
+	admin := testUser(t, q)
+	creator := testUser(t, q)
+	org, err := q.CreateOrganization(ctx, "test org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []db.Users{admin, creator} {
+		if _, err := q.AddOrgMember(ctx, db.AddOrgMemberParams{OrgID: org.ID, UserID: u.ID, Role: orgRoleAdmin}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hook, err := q.CreateWebhook(ctx, db.CreateWebhookParams{
+		OrgID:     uuid.NullUUID{UUID: org.ID, Valid: true},
+		Url:       "https://hooks.example.com/",
+		Secret:    "secret",
+		Events:    "instance.started",
+		CreatedBy: uuid.NullUUID{UUID: creator.ID, Valid: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.EnqueueWebhookDeliveries(ctx, db.EnqueueWebhookDeliveriesParams{
+		Event:   "instance.started",
+		Payload: json.RawMessage(`{}`),
+		UserID:  creator.ID,
+		OrgID:   uuid.NullUUID{UUID: org.ID, Valid: true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	deliveries, err := q.ListWebhookDeliveries(ctx, db.ListWebhookDeliveriesParams{WebhookID: hook.ID, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("deliveries = %d, want 1", len(deliveries))
+	}
+	d := deliveries[0]
+	if err := q.FailWebhookDelivery(ctx, db.FailWebhookDeliveryParams{
+		ID:             d.ID,
+		ResponseStatus: sql.NullInt32{Int32: 500, Valid: true},
+		Error:          "server error",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewWebhookHandler(q, nil)
+	w := serve(t, "POST", "/webhooks/:id/deliveries/:deliveryId/redeliver",
+		"/webhooks/"+hook.ID.String()+"/deliveries/"+d.ID.String()+"/redeliver", nil,
+		testSession(t, q, admin, false), h.Redeliver)
+	if w.Code != 200 {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+
+	// the admin who resent it and the webhook's creator both see the event
+	for _, u := range []db.Users{admin, creator} {
+		events, err := q.ListAuditEvents(ctx, db.ListAuditEventsParams{
+			UserID: uuid.NullUUID{UUID: u.ID, Valid: true},
+			Action: sql.NullString{String: auditWebhookRedelivered, Valid: true},
+			Limit:  10,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 1 {
+			t.Fatalf("%s sees %d redelivery events, want 1", u.Email, len(events))
+		}
+		if e := events[0]; e.ActorUserID.UUID != admin.ID || e.Target != hook.ID.String() {
+			t.Errorf("event = %+v", e)
+		}
+	}
+}
@@ -1,63 +1,228 @@
 package api
 
 import (
+	"database/sql"
+	"log/slog"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"time"
 
 	db "example.com/m/v2/db/sqlc"
+	"example.com/m/v2/internal/logging"
+	"example.com/m/v2/internal/metrics"
+	"example.com/m/v2/internal/tracing"
 	"example.com/m/v2/util"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const (
+	// shareQueryParam carries a share link token on the first request; it is
+	// then kept in shareCookie so the workspace's own assets load.
+	shareQueryParam = "share"
+	shareCookie     = "ws_share"
 )
 
 func WorkspaceProxy(cfg *util.Config, q *db.Queries) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		userIDStr := c.GetString("userID")
-		userUUID, err := uuid.Parse(userIDStr)
+		instanceUUID, err := uuid.Parse(c.Param("id"))
 		if err != nil {
-			c.JSON(401, gin.H{"error": "unauthorized"})
+			respondError(c, 400, "invalid instance id")
 			return
 		}
 
-		instanceUUID, err := uuid.Parse(c.Param("id"))
+		inst, err := q.GetInstanceByID(c, instanceUUID)
 		if err != nil {
-			c.JSON(400, gin.H{"error": "invalid instance id"})
+			respondError(c, 403, "forbidden")
 			return
 		}
 
-		inst, err := q.GetInstanceByID(c, instanceUUID)
-		if err != nil || inst.UserID != userUUID {
-			c.JSON(403, gin.H{"error": "forbidden"})
+		var readOnly bool
+		var roleErr error = sql.ErrNoRows
+
+		userUUID, authed := bearerUserID(c, q)
+		if authed {
+			logWith(c, slog.String(logging.UserIDKey, userUUID.String()))
+			var role string
+			role, roleErr = instanceRole(c, q, inst, userUUID)
+			readOnly = role == memberRoleViewer
+		}
+
+		if roleErr != nil {
+			share, ok := resolveShare(c, q, inst, userUUID, authed)
+			if !ok {
+				respondError(c, 403, "forbidden")
+				return
+			}
+			readOnly = share.Role == shareRoleView
+		}
+
+		if readOnly && !isReadOnlyRequest(c.Request) {
+			respondError(c, 403, "read-only access")
 			return
 		}
 
 		if !inst.ContainerID.Valid {
-			c.JSON(404, gin.H{"error": "instance not running"})
+			respondError(c, 404, "instance not running")
 			return
 		}
 
-		port := "80" 
+		port := "80"
 		targetURL, err := url.Parse(
 			"http://" + inst.ContainerID.String + ":" + port,
 		)
 		if err != nil {
-			c.JSON(500, gin.H{"error": "invalid target"})
+			respondError(c, 500, "invalid target")
 			return
 		}
 
 		proxy := httputil.NewSingleHostReverseProxy(targetURL)
 
-		proxy.Director = func(req *http.Request) {
-			req.URL.Scheme = targetURL.Scheme
-			req.URL.Host = targetURL.Host
-			req.Host = targetURL.Host
+		proxy.Director = workspaceDirector(targetURL, c.Param("path"))
+
+		protocol := "http"
+		if c.IsWebsocket() {
+			protocol = "websocket"
+		}
+		defer metrics.TrackProxy(inst.Type, protocol)()
+
+		ctx, span := tracing.Start(c.Request.Context(), "example.com/m/v2/api", "workspace.proxy",
+			attribute.String("instance.id", inst.ID.String()),
+			attribute.String("workspace.type", inst.Type),
+			attribute.String("network.protocol.name", protocol),
+		)
+		defer span.End()
 
-			req.URL.Path = "/"
+		w := newProxyWriter(c.Writer, inst.Type)
+		if c.Request.Body != nil {
+			c.Request.Body = countingBody{ReadCloser: c.Request.Body, in: w.in}
 		}
 
-		proxy.ServeHTTP(c.Writer, c.Request)
+		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			slog.ErrorContext(r.Context(), "workspace proxy failed", "error", err)
+			w.WriteHeader(http.StatusBadGateway)
+		}
+
+		proxy.ServeHTTP(w, c.Request.WithContext(ctx))
+	}
+}
+
+// workspaceDirector sends proxied requests to path on the workspace at
+// target.
+func workspaceDirector(target *url.URL, path string) func(*http.Request) {
+	return func(req *http.Request) {
+		req.URL.Scheme = target.Scheme
+		req.URL.Host = target.Host
+		req.Host = target.Host
+
+		req.URL.Path = path
+
+		query := req.URL.Query()
+		query.Del(shareQueryParam)
+		req.URL.RawQuery = query.Encode()
+
+		// the workspace belongs to someone else, who must not get the
+		// caller's credentials for this service
+		stripCredentials(req)
+
+		// workspaces that trace join ours
+		otel.GetTextMapPropagator().Inject(req.Context(), propagation.HeaderCarrier(req.Header))
+	}
+}
+
+// resolveShare looks up an active share link for the instance, either from
+// the link's query parameter or from the cookie set when the link was opened.
+// Opening a link is recorded in instance_share_accesses.
+func resolveShare(
+	c *gin.Context,
+	q *db.Queries,
+	inst db.Instances,
+	userUUID uuid.UUID,
+	authed bool,
+) (db.InstanceShares, bool) {
+
+	token := c.Query(shareQueryParam)
+	fromLink := token != ""
+	if !fromLink {
+		token, _ = c.Cookie(shareCookie)
+	}
+	if token == "" {
+		return db.InstanceShares{}, false
+	}
+
+	share, err := q.GetActiveInstanceShare(c, db.GetActiveInstanceShareParams{
+		TokenHash:  util.HashToken(token),
+		InstanceID: inst.ID,
+	})
+	if err != nil {
+		return db.InstanceShares{}, false
+	}
+
+	if fromLink {
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(
+			shareCookie,
+			token,
+			int(time.Until(share.ExpiresAt).Seconds()),
+			"/workspaces/"+inst.ID.String(),
+			"",
+			c.Request.TLS != nil,
+			true,
+		)
+
+		_ = q.CreateShareAccess(c, db.CreateShareAccessParams{
+			ShareID:    share.ID,
+			UserID:     uuid.NullUUID{UUID: userUUID, Valid: authed},
+			RemoteAddr: c.ClientIP(),
+			UserAgent:  c.Request.UserAgent(),
+		})
+		auditInstance(c, q, uuid.NullUUID{UUID: userUUID, Valid: authed}, inst, auditShareOpened, gin.H{
+			"share_id": share.ID,
+			"role":     share.Role,
+		})
+	}
+
+	return share, true
+}
+
+// appCookies are this service's own cookies. The workspace's cookies share
+// the origin, so they are told apart by name.
+var appCookies = map[string]bool{
+	shareCookie:     true,
+	oidcStateCookie: true,
+}
+
+// stripCredentials removes the Authorization header and this service's
+// cookies from a request about to be proxied, keeping the workspace's own
+// cookies.
+func stripCredentials(req *http.Request) {
+	req.Header.Del("Authorization")
+
+	cookies := req.Cookies()
+	req.Header.Del("Cookie")
+	for _, ck := range cookies {
+		if !appCookies[ck.Name] {
+			req.AddCookie(ck)
+		}
+	}
+}
+
+func isReadOnlyRequest(r *http.Request) bool {
+	if r.Header.Get("Upgrade") != "" {
+		return false
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
 	}
+	return false
 }
@@ -0,0 +1,45 @@
+-- name: ListAllInstances :many
+SELECT *
+FROM instances
+WHERE (sqlc.narg('status')::text IS NULL OR status = sqlc.narg('status'))
+  AND (sqlc.narg('type')::text IS NULL OR type = sqlc.narg('type'))
+  AND (sqlc.narg('user_id')::uuid IS NULL OR user_id = sqlc.narg('user_id'))
+  AND (sqlc.narg('org_id')::uuid IS NULL OR org_id = sqlc.narg('org_id'))
+ORDER BY created_at DESC
+LIMIT sqlc.arg('limit')
+OFFSET sqlc.arg('offset');
+
+
+-- name: ListRunningInstances :many
+SELECT *
+FROM instances
+WHERE status = 'running'
+  AND type != 'aws';
+
+
+-- name: CountInstancesByStatus :many
+SELECT type, status, COUNT(*) AS count
+FROM instances
+GROUP BY type, status
+ORDER BY type, status;
+
+
+-- name: DeleteInstance :exec
+DELETE FROM instances
+WHERE id = $1;
+
+
+-- name: ListUsers :many
+SELECT id, email, role, disabled_at, created_at
+FROM users
+WHERE (sqlc.narg('email')::text IS NULL OR email ILIKE '%' || sqlc.narg('email') || '%')
+ORDER BY created_at DESC
+LIMIT sqlc.arg('limit')
+OFFSET sqlc.arg('offset');
+
+
+-- name: SetUserDisabled :one
+UPDATE users
+SET disabled_at = CASE WHEN sqlc.arg('disabled')::bool THEN NOW() ELSE NULL END
+WHERE id = sqlc.arg('id')
+RETURNING *;
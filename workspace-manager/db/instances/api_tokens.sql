@@ -0,0 +1,41 @@
+-- name: CreateAPIToken :one
+INSERT INTO api_tokens (user_id, org_id, name, token_hash, prefix, scopes, expires_at, mfa_verified)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING *;
+
+
+-- name: GetAPITokenByHash :one
+SELECT *
+FROM api_tokens
+WHERE token_hash = $1
+LIMIT 1;
+
+
+-- name: ListUserAPITokens :many
+SELECT *
+FROM api_tokens
+WHERE user_id = $1
+  AND revoked_at IS NULL
+ORDER BY created_at DESC;
+
+
+-- name: RevokeAPIToken :execrows
+UPDATE api_tokens
+SET revoked_at = NOW()
+WHERE id = $1
+  AND user_id = $2
+  AND revoked_at IS NULL;
+
+
+-- name: RevokeUserAPITokens :exec
+UPDATE api_tokens
+SET revoked_at = NOW()
+WHERE user_id = $1
+  AND revoked_at IS NULL;
+
+
+-- name: TouchAPIToken :exec
+UPDATE api_tokens
+SET last_used_at = NOW()
+WHERE id = $1
+  AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute');
@@ -0,0 +1,25 @@
+-- name: CreateAuditEvent :exec
+INSERT INTO audit_events (actor_user_id, subject_user_id, instance_id, action, target, ip, request_id, metadata)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
+
+
+-- name: ListUserAuditEvents :many
+SELECT *
+FROM audit_events
+WHERE actor_user_id = $1
+ORDER BY occurred_at;
+
+
+-- name: ListAuditEvents :many
+SELECT *
+FROM audit_events
+WHERE (sqlc.narg('user_id')::uuid IS NULL OR actor_user_id = sqlc.narg('user_id') OR subject_user_id = sqlc.narg('user_id'))
+  AND (sqlc.narg('actor_user_id')::uuid IS NULL OR actor_user_id = sqlc.narg('actor_user_id'))
+  AND (sqlc.narg('instance_id')::uuid IS NULL OR instance_id = sqlc.narg('instance_id'))
+  AND (sqlc.narg('action')::text IS NULL OR action = sqlc.narg('action') OR starts_with(action, sqlc.narg('action') || '.'))
+  AND (sqlc.narg('since')::timestamptz IS NULL OR occurred_at >= sqlc.narg('since'))
+  AND (sqlc.narg('until')::timestamptz IS NULL OR occurred_at < sqlc.narg('until'))
+  AND (sqlc.narg('before_id')::bigint IS NULL OR id < sqlc.narg('before_id'))
+ORDER BY id DESC
+LIMIT sqlc.arg('limit')
+OFFSET sqlc.arg('offset');
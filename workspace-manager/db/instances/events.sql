@@ -0,0 +1,18 @@
+-- name: NotifyInstanceEvent :exec
+SELECT pg_notify('instance_events', sqlc.arg('payload'));
+
+
+-- name: ClaimExpiryWarnings :many
+WITH claimed AS (
+    INSERT INTO instance_expiry_warnings (instance_id)
+    SELECT id
+    FROM instances
+    WHERE status = 'running'
+      AND created_at + (ttl_hours || ' hours')::interval < NOW() + INTERVAL '15 minutes'
+    ON CONFLICT DO NOTHING
+    RETURNING instance_id
+)
+SELECT i.id, i.user_id, i.org_id,
+    (i.created_at + (i.ttl_hours || ' hours')::interval)::timestamptz AS expires_at
+FROM claimed
+JOIN instances i ON i.id = claimed.instance_id;
@@ -0,0 +1,70 @@
+-- name: CreateDataExport :one
+INSERT INTO data_exports (user_id, include_data)
+VALUES ($1, $2)
+RETURNING *;
+
+
+-- name: GetDataExport :one
+SELECT *
+FROM data_exports
+WHERE id = $1
+LIMIT 1;
+
+
+-- name: ListUserDataExports :many
+SELECT *
+FROM data_exports
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+
+-- name: ClaimDataExport :one
+UPDATE data_exports
+SET status = 'running',
+    started_at = NOW()
+WHERE id = (
+    SELECT id
+    FROM data_exports
+    WHERE status = 'pending'
+       OR (status = 'running' AND started_at < NOW() - INTERVAL '1 hour')
+    ORDER BY created_at
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+
+-- name: CompleteDataExport :exec
+UPDATE data_exports
+SET status = 'ready',
+    size_bytes = $2,
+    completed_at = NOW(),
+    expires_at = $3
+WHERE id = $1;
+
+
+-- name: FailDataExport :exec
+UPDATE data_exports
+SET status = 'failed',
+    error = $2,
+    completed_at = NOW()
+WHERE id = $1;
+
+
+-- name: ListExpiredDataExports :many
+SELECT *
+FROM data_exports
+WHERE expires_at < NOW();
+
+
+-- name: DeleteDataExport :exec
+DELETE FROM data_exports
+WHERE id = $1;
+
+
+-- name: ReleaseDataExport :exec
+UPDATE data_exports
+SET status = 'pending',
+    started_at = NULL
+WHERE id = $1
+  AND status = 'running';
@@ -7,9 +7,10 @@ INSERT INTO instances (
     ttl_hours,
     console_url,
     aws_username,
-    aws_password
+    aws_password,
+    org_id
 ) VALUES (
-    $1, $2, $3, $4, $5, $6, $7, $8
+    $1, $2, $3, $4, $5, $6, $7, $8, $9
 )
 RETURNING *;
 
@@ -75,6 +76,21 @@ WHERE
 
 
 
+-- name: TransferOrgInstances :execrows
+UPDATE instances i
+SET user_id = (
+    SELECT m.user_id
+    FROM org_members m
+    WHERE m.org_id = i.org_id
+      AND m.role = 'admin'
+      AND m.user_id != $1
+    ORDER BY m.created_at
+    LIMIT 1
+)
+WHERE i.user_id = $1
+  AND i.org_id IS NOT NULL;
+
+
 -- name: StopExpiredInstance :exec
 UPDATE instances
 SET
@@ -0,0 +1,28 @@
+-- name: CreateSignupInvite :one
+INSERT INTO signup_invites (code_hash, email, max_uses, created_by, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING *;
+
+
+-- name: ListSignupInvites :many
+SELECT *
+FROM signup_invites
+ORDER BY created_at DESC;
+
+
+-- name: RevokeSignupInvite :execrows
+UPDATE signup_invites
+SET revoked_at = NOW()
+WHERE id = $1
+  AND revoked_at IS NULL;
+
+
+-- name: UseSignupInvite :one
+UPDATE signup_invites
+SET uses = uses + 1
+WHERE code_hash = $1
+  AND (email IS NULL OR email = $2)
+  AND uses < max_uses
+  AND revoked_at IS NULL
+  AND expires_at > NOW()
+RETURNING *;
@@ -0,0 +1,69 @@
+-- name: AddInstanceMember :one
+INSERT INTO instance_members (
+    instance_id,
+    user_id,
+    role,
+    invited_by
+) VALUES (
+    $1, $2, $3, $4
+)
+RETURNING *;
+
+
+-- name: GetInstanceMember :one
+SELECT *
+FROM instance_members
+WHERE instance_id = $1
+  AND user_id = $2
+LIMIT 1;
+
+
+-- name: ListInstanceMembers :many
+SELECT
+    m.instance_id,
+    m.user_id,
+    u.email,
+    m.role,
+    m.invited_by,
+    m.created_at
+FROM instance_members m
+JOIN users u ON u.id = m.user_id
+WHERE m.instance_id = $1
+ORDER BY m.created_at;
+
+
+-- name: UpdateInstanceMemberRole :one
+UPDATE instance_members
+SET role = $3
+WHERE instance_id = $1
+  AND user_id = $2
+RETURNING *;
+
+
+-- name: RemoveInstanceMember :execrows
+DELETE FROM instance_members
+WHERE instance_id = $1
+  AND user_id = $2;
+
+
+-- name: RemoveOrgInstanceMemberships :exec
+DELETE FROM instance_members m
+USING instances i
+WHERE m.instance_id = i.id
+  AND i.org_id = $1
+  AND m.user_id = $2;
+
+
+-- name: CountInstanceOwners :one
+SELECT COUNT(*)
+FROM instance_members
+WHERE instance_id = $1
+  AND role = 'owner';
+
+
+-- name: ListMemberInstances :many
+SELECT i.*
+FROM instances i
+JOIN instance_members m ON m.instance_id = i.id
+WHERE m.user_id = $1
+ORDER BY i.created_at DESC;
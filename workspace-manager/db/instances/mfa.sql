@@ -0,0 +1,77 @@
+-- name: GetUserMFA :one
+SELECT *
+FROM user_mfa
+WHERE user_id = $1
+LIMIT 1;
+
+
+-- name: StartMFAEnrollment :one
+INSERT INTO user_mfa (user_id, secret)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret,
+    last_used_step = 0,
+    created_at = NOW()
+WHERE user_mfa.enabled_at IS NULL
+RETURNING *;
+
+
+-- name: EnableMFA :exec
+UPDATE user_mfa
+SET enabled_at = NOW()
+WHERE user_id = $1;
+
+
+-- name: UseMFAStep :execrows
+UPDATE user_mfa
+SET last_used_step = $2
+WHERE user_id = $1
+  AND last_used_step < $2;
+
+
+-- name: DeleteUserMFA :exec
+DELETE FROM user_mfa
+WHERE user_id = $1;
+
+
+-- name: CreateRecoveryCode :exec
+INSERT INTO mfa_recovery_codes (user_id, code_hash)
+VALUES ($1, $2);
+
+
+-- name: UseRecoveryCode :execrows
+UPDATE mfa_recovery_codes
+SET used_at = NOW()
+WHERE user_id = $1
+  AND code_hash = $2
+  AND used_at IS NULL;
+
+
+-- name: CountRecoveryCodes :one
+SELECT COUNT(*)
+FROM mfa_recovery_codes
+WHERE user_id = $1
+  AND used_at IS NULL;
+
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM mfa_recovery_codes
+WHERE user_id = $1;
+
+
+-- name: CreateMFAChallenge :exec
+INSERT INTO mfa_challenges (token_hash, user_id, org_id, expires_at)
+VALUES ($1, $2, $3, $4);
+
+
+-- name: AttemptMFAChallenge :one
+UPDATE mfa_challenges
+SET attempts = attempts + 1
+WHERE token_hash = $1
+  AND expires_at > NOW()
+RETURNING *;
+
+
+-- name: DeleteMFAChallenge :exec
+DELETE FROM mfa_challenges
+WHERE token_hash = $1;
@@ -0,0 +1,35 @@
+-- name: CreateOIDCAuthRequest :exec
+INSERT INTO oidc_auth_requests (state_hash, code_verifier, nonce, expires_at)
+VALUES ($1, $2, $3, $4);
+
+
+-- name: ConsumeOIDCAuthRequest :one
+DELETE FROM oidc_auth_requests
+WHERE state_hash = $1
+RETURNING *;
+
+
+-- name: DeleteExpiredOIDCAuthRequests :exec
+DELETE FROM oidc_auth_requests
+WHERE expires_at < NOW();
+
+
+-- name: GetUserIdentity :one
+SELECT *
+FROM user_identities
+WHERE issuer = $1
+  AND subject = $2
+LIMIT 1;
+
+
+-- name: CreateUserIdentity :one
+INSERT INTO user_identities (issuer, subject, user_id, email)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+
+-- name: ListUserIdentities :many
+SELECT *
+FROM user_identities
+WHERE user_id = $1
+ORDER BY created_at;
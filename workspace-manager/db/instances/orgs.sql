@@ -0,0 +1,122 @@
+-- name: CreateOrganization :one
+INSERT INTO organizations (name)
+VALUES ($1)
+RETURNING *;
+
+
+-- name: GetOrganization :one
+SELECT *
+FROM organizations
+WHERE id = $1
+LIMIT 1;
+
+
+-- name: LockOrganization :one
+SELECT *
+FROM organizations
+WHERE id = $1
+FOR UPDATE;
+
+
+-- name: UpdateOrganizationQuota :one
+UPDATE organizations
+SET
+    max_instances = $2,
+    max_running_instances = $3
+WHERE id = $1
+RETURNING *;
+
+
+-- name: ListUserOrganizations :many
+SELECT
+    o.id,
+    o.name,
+    o.max_instances,
+    o.max_running_instances,
+    o.created_at,
+    o.require_mfa,
+    m.role
+FROM organizations o
+JOIN org_members m ON m.org_id = o.id
+WHERE m.user_id = $1
+ORDER BY o.created_at;
+
+
+-- name: AddOrgMember :one
+INSERT INTO org_members (
+    org_id,
+    user_id,
+    role
+) VALUES (
+    $1, $2, $3
+)
+RETURNING *;
+
+
+-- name: GetOrgMember :one
+SELECT *
+FROM org_members
+WHERE org_id = $1
+  AND user_id = $2
+LIMIT 1;
+
+
+-- name: ListOrgMembers :many
+SELECT
+    m.org_id,
+    m.user_id,
+    u.email,
+    m.role,
+    m.created_at
+FROM org_members m
+JOIN users u ON u.id = m.user_id
+WHERE m.org_id = $1
+ORDER BY m.created_at;
+
+
+-- name: UpdateOrgMemberRole :one
+UPDATE org_members
+SET role = $3
+WHERE org_id = $1
+  AND user_id = $2
+RETURNING *;
+
+
+-- name: RemoveOrgMember :execrows
+DELETE FROM org_members
+WHERE org_id = $1
+  AND user_id = $2;
+
+
+-- name: CountOrgAdmins :one
+SELECT COUNT(*)
+FROM org_members
+WHERE org_id = $1
+  AND role = 'admin';
+
+
+-- name: ListOrgInstances :many
+SELECT *
+FROM instances
+WHERE org_id = $1
+ORDER BY created_at DESC;
+
+
+-- name: CountOrgInstances :one
+SELECT COUNT(*)
+FROM instances
+WHERE org_id = $1;
+
+
+-- name: CountOrgRunningInstances :one
+SELECT COUNT(*)
+FROM instances
+WHERE org_id = $1
+  AND status = 'running';
+
+
+-- name: SetOrganizationRequireMFA :one
+UPDATE organizations
+SET require_mfa = $2
+WHERE id = $1
+RETURNING *;
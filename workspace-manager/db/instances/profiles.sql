@@ -0,0 +1,25 @@
+-- name: GetUserProfile :one
+SELECT *
+FROM user_profiles
+WHERE user_id = $1
+LIMIT 1;
+
+
+-- name: UpsertUserProfile :one
+INSERT INTO user_profiles (
+    user_id,
+    display_name,
+    avatar_url,
+    timezone,
+    default_instance_type,
+    default_ttl_hours
+)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (user_id) DO UPDATE
+SET display_name = EXCLUDED.display_name,
+    avatar_url = EXCLUDED.avatar_url,
+    timezone = EXCLUDED.timezone,
+    default_instance_type = EXCLUDED.default_instance_type,
+    default_ttl_hours = EXCLUDED.default_ttl_hours,
+    updated_at = NOW()
+RETURNING *;
@@ -0,0 +1,17 @@
+-- name: ListRoles :many
+SELECT *
+FROM roles
+ORDER BY name;
+
+
+-- name: ListRolePermissions :many
+SELECT *
+FROM role_permissions
+ORDER BY role, permission;
+
+
+-- name: SetUserRole :one
+UPDATE users
+SET role = $2
+WHERE id = $1
+RETURNING *;
@@ -0,0 +1,60 @@
+-- name: CreateSession :one
+INSERT INTO sessions (user_id, org_id, mfa_verified)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+
+-- name: GetSession :one
+SELECT *
+FROM sessions
+WHERE id = $1
+LIMIT 1;
+
+
+-- name: SetSessionOrg :exec
+UPDATE sessions
+SET org_id = $2
+WHERE id = $1;
+
+
+-- name: RevokeSession :exec
+UPDATE sessions
+SET revoked_at = NOW()
+WHERE id = $1
+  AND revoked_at IS NULL;
+
+
+-- name: RevokeUserSessions :exec
+UPDATE sessions
+SET revoked_at = NOW()
+WHERE user_id = $1
+  AND revoked_at IS NULL;
+
+
+-- name: CreateRefreshToken :one
+INSERT INTO refresh_tokens (token_hash, session_id, expires_at)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+
+-- name: GetRefreshToken :one
+SELECT *
+FROM refresh_tokens
+WHERE token_hash = $1
+LIMIT 1;
+
+
+-- name: UseRefreshToken :one
+UPDATE refresh_tokens
+SET used_at = NOW()
+WHERE token_hash = $1
+  AND used_at IS NULL
+RETURNING *;
+
+
+-- name: RevokeOtherUserSessions :exec
+UPDATE sessions
+SET revoked_at = NOW()
+WHERE user_id = $1
+  AND id <> $2
+  AND revoked_at IS NULL;
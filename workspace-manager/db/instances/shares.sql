@@ -0,0 +1,63 @@
+-- name: CreateInstanceShare :one
+INSERT INTO instance_shares (
+    instance_id,
+    created_by,
+    token_hash,
+    role,
+    expires_at
+) VALUES (
+    $1, $2, $3, $4, $5
+)
+RETURNING *;
+
+
+-- name: ListInstanceShares :many
+SELECT *
+FROM instance_shares
+WHERE instance_id = $1
+ORDER BY created_at DESC;
+
+
+-- name: GetInstanceShare :one
+SELECT *
+FROM instance_shares
+WHERE id = $1
+  AND instance_id = $2
+LIMIT 1;
+
+
+-- name: GetActiveInstanceShare :one
+SELECT *
+FROM instance_shares
+WHERE token_hash = $1
+  AND instance_id = $2
+  AND revoked_at IS NULL
+  AND expires_at > NOW()
+LIMIT 1;
+
+
+-- name: RevokeInstanceShare :one
+UPDATE instance_shares
+SET revoked_at = NOW()
+WHERE id = $1
+  AND instance_id = $2
+  AND revoked_at IS NULL
+RETURNING *;
+
+
+-- name: CreateShareAccess :exec
+INSERT INTO instance_share_accesses (
+    share_id,
+    user_id,
+    remote_addr,
+    user_agent
+) VALUES (
+    $1, $2, $3, $4
+);
+
+
+-- name: ListShareAccesses :many
+SELECT *
+FROM instance_share_accesses
+WHERE share_id = $1
+ORDER BY accessed_at DESC;
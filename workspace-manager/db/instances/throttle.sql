@@ -0,0 +1,22 @@
+-- name: GetLoginThrottle :one
+SELECT *
+FROM login_throttles
+WHERE key = $1
+LIMIT 1;
+
+
+-- name: RecordLoginFailure :one
+INSERT INTO login_throttles (key, failures, last_failure_at)
+VALUES ($1, 1, NOW())
+ON CONFLICT (key) DO UPDATE
+SET failures = CASE
+        WHEN login_throttles.last_failure_at < NOW() - INTERVAL '1 hour' THEN 1
+        ELSE login_throttles.failures + 1
+    END,
+    last_failure_at = NOW()
+RETURNING *;
+
+
+-- name: ClearLoginThrottle :exec
+DELETE FROM login_throttles
+WHERE key = $1;
@@ -6,7 +6,7 @@ RETURNING *;
 -- name: GetUserByEmail :one
 SELECT *
 FROM users
-WHERE email = $1
+WHERE lower(email) = lower($1)
 LIMIT 1;
 
 -- name: GetUserByID :one
@@ -14,3 +14,17 @@ SELECT *
 FROM users
 WHERE id = $1
 LIMIT 1;
+
+-- name: MarkEmailVerified :exec
+UPDATE users
+SET email_verified_at = COALESCE(email_verified_at, NOW())
+WHERE id = $1;
+
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET password = $2
+WHERE id = $1;
+
+-- name: DeleteUser :exec
+DELETE FROM users
+WHERE id = $1;
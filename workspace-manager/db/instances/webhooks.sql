@@ -0,0 +1,131 @@
+-- name: CreateWebhook :one
+INSERT INTO webhooks (user_id, org_id, url, secret, events, created_by)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+
+-- name: GetWebhook :one
+SELECT *
+FROM webhooks
+WHERE id = $1
+LIMIT 1;
+
+
+-- name: ListUserWebhooks :many
+SELECT *
+FROM webhooks
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+
+-- name: ListOrgWebhooks :many
+SELECT *
+FROM webhooks
+WHERE org_id = $1
+ORDER BY created_at DESC;
+
+
+-- name: UpdateWebhook :one
+UPDATE webhooks
+SET url = COALESCE(sqlc.narg('url'), url),
+    events = COALESCE(sqlc.narg('events'), events),
+    enabled = COALESCE(sqlc.narg('enabled'), enabled),
+    updated_at = NOW()
+WHERE id = sqlc.arg('id')
+RETURNING *;
+
+
+-- name: RotateWebhookSecret :one
+UPDATE webhooks
+SET secret = $2,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+
+-- name: DeleteWebhook :exec
+DELETE FROM webhooks
+WHERE id = $1;
+
+
+-- name: EnqueueWebhookDeliveries :execrows
+INSERT INTO webhook_deliveries (webhook_id, event, payload)
+SELECT id, sqlc.arg('event')::text, sqlc.arg('payload')::jsonb
+FROM webhooks
+WHERE enabled
+  AND ((user_id = sqlc.arg('user_id') AND sqlc.narg('org_id')::uuid IS NULL) OR org_id = sqlc.narg('org_id'))
+  AND sqlc.arg('event') = ANY(string_to_array(events, ' '));
+
+
+-- name: ClaimWebhookDeliveries :many
+UPDATE webhook_deliveries d
+SET attempts = d.attempts + 1,
+    last_attempt_at = NOW(),
+    next_attempt_at = NOW() + INTERVAL '5 minutes'
+FROM webhooks w
+WHERE w.id = d.webhook_id
+  AND d.id IN (
+    SELECT due.id
+    FROM webhook_deliveries due
+    JOIN webhooks hook ON hook.id = due.webhook_id
+    WHERE due.status = 'pending'
+      AND due.next_attempt_at <= NOW()
+      AND hook.enabled
+    ORDER BY due.next_attempt_at
+    LIMIT $1
+    FOR UPDATE OF due SKIP LOCKED
+  )
+RETURNING d.id, d.webhook_id, d.event, d.payload, d.attempts, w.url, w.secret;
+
+
+-- name: CompleteWebhookDelivery :exec
+UPDATE webhook_deliveries
+SET status = 'delivered',
+    response_status = $2,
+    error = '',
+    delivered_at = NOW()
+WHERE id = $1;
+
+
+-- name: RetryWebhookDelivery :exec
+UPDATE webhook_deliveries
+SET response_status = $2,
+    error = $3,
+    next_attempt_at = $4
+WHERE id = $1;
+
+
+-- name: FailWebhookDelivery :exec
+UPDATE webhook_deliveries
+SET status = 'failed',
+    response_status = $2,
+    error = $3
+WHERE id = $1;
+
+
+-- name: RedeliverWebhookDelivery :one
+UPDATE webhook_deliveries
+SET status = 'pending',
+    attempts = 0,
+    next_attempt_at = NOW(),
+    delivered_at = NULL
+WHERE id = $1
+  AND webhook_id = $2
+  AND status <> 'pending'
+RETURNING *;
+
+
+-- name: ListWebhookDeliveries :many
+SELECT *
+FROM webhook_deliveries
+WHERE webhook_id = sqlc.arg('webhook_id')
+  AND (sqlc.narg('status')::text IS NULL OR status = sqlc.narg('status'))
+ORDER BY created_at DESC
+LIMIT sqlc.arg('limit')
+OFFSET sqlc.arg('offset');
+
+
+-- name: DeleteOldWebhookDeliveries :execrows
+DELETE FROM webhook_deliveries
+WHERE status <> 'pending'
+  AND created_at < $1;
@@ -13,8 +13,8 @@ CREATE TABLE instances (
     id UUID PRIMARY KEY,
     user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
 
-    -- vscode | jupyter | mysql
-    type TEXT NOT NULL CHECK (type IN ('vscode', 'jupyter', 'mysql')),
+    -- vscode | jupyter | mysql | langflow | weaviate | aws
+    type TEXT NOT NULL,
 
     status TEXT NOT NULL DEFAULT 'stopped',
 
@@ -26,37 +26,24 @@ CREATE TABLE instances (
 
     ttl_hours INT NOT NULL,
     last_active TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
-);
-
-CREATE INDEX idx_instances_user ON instances(user_id);
-CREATE INDEX idx_instances_last_active ON instances(last_active);
-CREATE INDEX idx_instances_status ON instances(status);
-ALTER TABLE instances
-DROP CONSTRAINT instances_type_check;
-
-ALTER TABLE instances
-ADD CONSTRAINT instances_type_check
-CHECK (type IN ('vscode', 'jupyter', 'mysql', 'langflow'));
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
 
-ALTER TABLE instances
-DROP CONSTRAINT instances_type_check;
+    console_url TEXT,
 
-ALTER TABLE instances
-ADD CONSTRAINT instances_type_check
-CHECK (type IN ('vscode', 'jupyter', 'mysql', 'langflow', 'weaviate','aws'));
+    -- AWS console instances run no container
+    aws_username TEXT,
+    aws_password TEXT,
 
-ALTER TABLE instances ADD COLUMN console_url TEXT;
+    CONSTRAINT instances_type_check
+    CHECK (type IN ('vscode', 'jupyter', 'mysql', 'langflow', 'weaviate', 'aws')),
 
-
-ALTER TABLE instances
-ADD COLUMN aws_username TEXT,
-ADD COLUMN aws_password TEXT;
-
-ALTER TABLE instances
-ADD CONSTRAINT aws_no_container
-CHECK (
-  type != 'aws'
-  OR (container_id IS NULL AND host_port IS NULL)
+    CONSTRAINT aws_no_container
+    CHECK (
+      type != 'aws'
+      OR (container_id IS NULL AND host_port IS NULL)
+    )
 );
 
+CREATE INDEX idx_instances_user ON instances(user_id);
+CREATE INDEX idx_instances_last_active ON instances(last_active);
+CREATE INDEX idx_instances_status ON instances(status);
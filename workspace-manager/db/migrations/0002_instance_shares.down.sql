@@ -0,0 +1,2 @@
+DROP TABLE instance_share_accesses;
+DROP TABLE instance_shares;
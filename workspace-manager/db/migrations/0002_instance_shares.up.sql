@@ -0,0 +1,28 @@
+CREATE TABLE instance_shares (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    instance_id UUID NOT NULL REFERENCES instances(id) ON DELETE CASCADE,
+    created_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    -- sha256 of the link token; the token itself is only returned once
+    token_hash TEXT UNIQUE NOT NULL,
+
+    -- view | full
+    role TEXT NOT NULL CHECK (role IN ('view', 'full')),
+
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_instance_shares_instance ON instance_shares(instance_id);
+
+CREATE TABLE instance_share_accesses (
+    id BIGSERIAL PRIMARY KEY,
+    share_id UUID NOT NULL REFERENCES instance_shares(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    remote_addr TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    accessed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_instance_share_accesses_share ON instance_share_accesses(share_id);
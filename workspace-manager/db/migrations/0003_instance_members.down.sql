@@ -0,0 +1 @@
+DROP TABLE instance_members;
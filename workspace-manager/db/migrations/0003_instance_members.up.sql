@@ -0,0 +1,19 @@
+CREATE TABLE instance_members (
+    instance_id UUID NOT NULL REFERENCES instances(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    -- owner | editor | viewer
+    role TEXT NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+
+    invited_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (instance_id, user_id)
+);
+
+CREATE INDEX idx_instance_members_user ON instance_members(user_id);
+
+INSERT INTO instance_members (instance_id, user_id, role)
+SELECT id, user_id, 'owner'
+FROM instances
+ON CONFLICT DO NOTHING;
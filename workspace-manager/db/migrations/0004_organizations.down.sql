@@ -0,0 +1,4 @@
+ALTER TABLE instances DROP COLUMN org_id;
+
+DROP TABLE org_members;
+DROP TABLE organizations;
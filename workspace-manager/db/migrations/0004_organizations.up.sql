@@ -0,0 +1,29 @@
+CREATE TABLE organizations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name TEXT NOT NULL,
+
+    -- shared quotas across all org-owned instances, NULL = unlimited
+    max_instances INT,
+    max_running_instances INT,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE org_members (
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    -- admin | member
+    role TEXT NOT NULL CHECK (role IN ('admin', 'member')),
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (org_id, user_id)
+);
+
+CREATE INDEX idx_org_members_user ON org_members(user_id);
+
+ALTER TABLE instances
+ADD COLUMN org_id UUID REFERENCES organizations(id);
+
+CREATE INDEX idx_instances_org ON instances(org_id);
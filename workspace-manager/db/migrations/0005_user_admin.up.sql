@@ -0,0 +1,3 @@
+ALTER TABLE users
+ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT false,
+ADD COLUMN disabled_at TIMESTAMPTZ;
@@ -0,0 +1,9 @@
+ALTER TABLE users
+ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT false;
+
+UPDATE users SET is_admin = true WHERE role = 'platform-admin';
+
+ALTER TABLE users DROP COLUMN role;
+
+DROP TABLE role_permissions;
+DROP TABLE roles;
@@ -0,0 +1,53 @@
+CREATE TABLE roles (
+    name TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE role_permissions (
+    role TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    permission TEXT NOT NULL,
+
+    PRIMARY KEY (role, permission)
+);
+
+INSERT INTO roles (name, description) VALUES
+    ('user', 'Runs their own workspaces and joins organizations'),
+    ('instructor', 'User who can also use instructor features'),
+    ('org-admin', 'User who can also create organizations'),
+    ('platform-admin', 'Operates the whole platform');
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('user', 'instances:read'),
+    ('user', 'instances:write'),
+    ('user', 'orgs:read'),
+    ('user', 'orgs:write'),
+
+    ('instructor', 'instances:read'),
+    ('instructor', 'instances:write'),
+    ('instructor', 'orgs:read'),
+    ('instructor', 'orgs:write'),
+    ('instructor', 'instructor:read'),
+    ('instructor', 'instructor:write'),
+
+    ('org-admin', 'instances:read'),
+    ('org-admin', 'instances:write'),
+    ('org-admin', 'orgs:read'),
+    ('org-admin', 'orgs:write'),
+    ('org-admin', 'orgs:create'),
+
+    ('platform-admin', 'instances:read'),
+    ('platform-admin', 'instances:write'),
+    ('platform-admin', 'orgs:read'),
+    ('platform-admin', 'orgs:write'),
+    ('platform-admin', 'orgs:create'),
+    ('platform-admin', 'instructor:read'),
+    ('platform-admin', 'instructor:write'),
+    ('platform-admin', 'admin:read'),
+    ('platform-admin', 'admin:write');
+
+ALTER TABLE users
+ADD COLUMN role TEXT NOT NULL DEFAULT 'user' REFERENCES roles(name);
+
+UPDATE users SET role = 'platform-admin' WHERE is_admin;
+
+ALTER TABLE users DROP COLUMN is_admin;
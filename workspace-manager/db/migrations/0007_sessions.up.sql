@@ -0,0 +1,26 @@
+CREATE TABLE sessions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    -- organization the session is acting in; NULL for personal use
+    org_id UUID REFERENCES organizations(id) ON DELETE SET NULL,
+
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_sessions_user ON sessions(user_id);
+
+-- Refresh tokens rotate on every use. Every token issued for a session shares
+-- its session_id, so presenting an already-used one revokes the whole chain.
+CREATE TABLE refresh_tokens (
+    -- sha256 of the token; the token itself is only returned once
+    token_hash TEXT PRIMARY KEY,
+    session_id UUID NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_refresh_tokens_session ON refresh_tokens(session_id);
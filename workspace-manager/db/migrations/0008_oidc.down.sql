@@ -0,0 +1,2 @@
+DROP TABLE oidc_auth_requests;
+DROP TABLE user_identities;
@@ -0,0 +1,28 @@
+-- External identities (OIDC issuer + subject) linked to a local account.
+-- Accounts created through SSO have an empty password and cannot use
+-- password login.
+CREATE TABLE user_identities (
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    -- email the provider asserted when the identity was linked
+    email TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (issuer, subject)
+);
+
+CREATE INDEX idx_user_identities_user ON user_identities(user_id);
+
+-- In-flight OIDC logins, consumed by the callback.
+CREATE TABLE oidc_auth_requests (
+    -- sha256 of the state parameter
+    state_hash TEXT PRIMARY KEY,
+
+    code_verifier TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,18 @@
+ALTER TABLE users
+ADD COLUMN email_verified_at TIMESTAMPTZ;
+
+-- Single-use tokens mailed to users: email verification and password reset.
+CREATE TABLE email_tokens (
+    -- sha256 of the token; the token itself is only sent by email
+    token_hash TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    -- verify_email | password_reset
+    purpose TEXT NOT NULL CHECK (purpose IN ('verify_email', 'password_reset')),
+
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_email_tokens_user ON email_tokens(user_id, purpose);
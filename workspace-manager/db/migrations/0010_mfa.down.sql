@@ -0,0 +1,6 @@
+ALTER TABLE organizations DROP COLUMN require_mfa;
+ALTER TABLE sessions DROP COLUMN mfa_verified;
+
+DROP TABLE mfa_challenges;
+DROP TABLE mfa_recovery_codes;
+DROP TABLE user_mfa;
@@ -0,0 +1,45 @@
+-- TOTP second factor. A row with enabled_at NULL is an enrollment that has
+-- not been confirmed with a code yet.
+CREATE TABLE user_mfa (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+
+    -- base32 TOTP secret
+    secret TEXT NOT NULL,
+
+    -- last accepted 30s time step, so a code cannot be replayed
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+
+    enabled_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE mfa_recovery_codes (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    -- sha256 of the normalized code
+    code_hash TEXT NOT NULL,
+
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_mfa_recovery_codes_user ON mfa_recovery_codes(user_id);
+
+-- Password logins waiting for the second factor.
+CREATE TABLE mfa_challenges (
+    -- sha256 of the challenge token handed to the client
+    token_hash TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    org_id UUID REFERENCES organizations(id) ON DELETE CASCADE,
+
+    attempts INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE sessions
+ADD COLUMN mfa_verified BOOLEAN NOT NULL DEFAULT false;
+
+ALTER TABLE organizations
+ADD COLUMN require_mfa BOOLEAN NOT NULL DEFAULT false;
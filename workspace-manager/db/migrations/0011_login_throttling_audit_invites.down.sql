@@ -0,0 +1,3 @@
+DROP TABLE signup_invites;
+DROP TABLE audit_events;
+DROP TABLE login_throttles;
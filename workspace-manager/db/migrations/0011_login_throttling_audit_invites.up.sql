@@ -0,0 +1,40 @@
+-- Failed login counters, keyed by "ip:<addr>" or "account:<email>".
+CREATE TABLE login_throttles (
+    key TEXT PRIMARY KEY,
+    failures INT NOT NULL,
+    last_failure_at TIMESTAMPTZ NOT NULL
+);
+
+-- Security-relevant events such as failed logins.
+CREATE TABLE audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    occurred_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    -- NULL when the actor is anonymous, e.g. a failed login
+    actor_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+
+    action TEXT NOT NULL,
+    target TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    metadata JSONB NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX idx_audit_events_action ON audit_events(action, occurred_at);
+
+-- Invite codes for closed signup. An invite bound to an email only works
+-- for that address.
+CREATE TABLE signup_invites (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+
+    -- sha256 of the invite code; the code itself is only returned once
+    code_hash TEXT UNIQUE NOT NULL,
+
+    email TEXT,
+    max_uses INT NOT NULL DEFAULT 1,
+    uses INT NOT NULL DEFAULT 0,
+
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,25 @@
+-- Personal access tokens for scripts and CI. A token acts as its user, in
+-- the organization it was created in, limited to its scopes.
+CREATE TABLE api_tokens (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    org_id UUID REFERENCES organizations(id) ON DELETE CASCADE,
+
+    name TEXT NOT NULL,
+
+    -- sha256 of the token; the token itself is only returned once
+    token_hash TEXT UNIQUE NOT NULL,
+
+    -- leading characters of the token, so users can tell tokens apart
+    prefix TEXT NOT NULL,
+
+    -- space-separated permissions, e.g. 'instances:read instances:write'
+    scopes TEXT NOT NULL,
+
+    expires_at TIMESTAMPTZ NOT NULL,
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_api_tokens_user ON api_tokens(user_id);
@@ -0,0 +1,3 @@
+-- Emails are compared case-insensitively; clients' input is lowercased too,
+-- but older rows may not be.
+CREATE UNIQUE INDEX idx_users_email_lower ON users (lower(email));
@@ -0,0 +1,17 @@
+-- Self-service profile and preferences. Users without a row have the
+-- defaults.
+CREATE TABLE user_profiles (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+
+    display_name TEXT NOT NULL DEFAULT '',
+    avatar_url TEXT NOT NULL DEFAULT '',
+
+    -- IANA name, e.g. 'Europe/Berlin'
+    timezone TEXT NOT NULL DEFAULT 'UTC',
+
+    -- applied to new instances that leave them out
+    default_instance_type TEXT,
+    default_ttl_hours INT,
+
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,24 @@
+-- Personal data exports, built in the background. The archive lives at
+-- <export dir>/<user_id>/<id>.zip until expires_at.
+CREATE TABLE data_exports (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    -- also copy the user's workspace data directories
+    include_data BOOLEAN NOT NULL DEFAULT false,
+
+    -- pending | running | ready | failed
+    status TEXT NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'running', 'ready', 'failed')),
+    error TEXT NOT NULL DEFAULT '',
+    size_bytes BIGINT,
+
+    started_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- one export in progress per user
+CREATE UNIQUE INDEX idx_data_exports_active ON data_exports(user_id)
+WHERE status IN ('pending', 'running');
@@ -0,0 +1,11 @@
+DROP TRIGGER audit_events_no_truncate ON audit_events;
+DROP TRIGGER audit_events_append_only ON audit_events;
+DROP FUNCTION audit_events_append_only();
+
+DROP INDEX idx_audit_events_instance;
+DROP INDEX idx_audit_events_subject;
+DROP INDEX idx_audit_events_actor;
+
+ALTER TABLE audit_events DROP COLUMN request_id;
+ALTER TABLE audit_events DROP COLUMN instance_id;
+ALTER TABLE audit_events DROP COLUMN subject_user_id;
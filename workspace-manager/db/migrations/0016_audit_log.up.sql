@@ -0,0 +1,44 @@
+-- Widen the audit log to instance lifecycle and sharing events, and make it
+-- append-only.
+
+-- the user an event concerns when they did not cause it, e.g. the owner of
+-- an instance an admin stopped; they see it among their own events
+ALTER TABLE audit_events
+    ADD COLUMN subject_user_id UUID REFERENCES users(id) ON DELETE SET NULL;
+
+-- no foreign key: the record has to outlive the instance
+ALTER TABLE audit_events ADD COLUMN instance_id UUID;
+
+-- joins an event to the request's log records
+ALTER TABLE audit_events ADD COLUMN request_id TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX idx_audit_events_actor ON audit_events(actor_user_id, id);
+CREATE INDEX idx_audit_events_subject ON audit_events(subject_user_id, id);
+CREATE INDEX idx_audit_events_instance ON audit_events(instance_id, id);
+
+-- Events can only be added. The one change allowed is the foreign keys
+-- clearing a deleted user's ID, so erasing an account keeps working; the
+-- rest of the record stays.
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE'
+        AND (NEW.actor_user_id IS NULL OR NEW.actor_user_id = OLD.actor_user_id)
+        AND (NEW.subject_user_id IS NULL OR NEW.subject_user_id = OLD.subject_user_id)
+        AND (NEW.id, NEW.occurred_at, NEW.action, NEW.target, NEW.ip, NEW.metadata, NEW.instance_id, NEW.request_id)
+            IS NOT DISTINCT FROM
+            (OLD.id, OLD.occurred_at, OLD.action, OLD.target, OLD.ip, OLD.metadata, OLD.instance_id, OLD.request_id)
+    THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'audit_events is append-only'
+        USING ERRCODE = 'insufficient_privilege';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+BEFORE UPDATE OR DELETE ON audit_events
+FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+CREATE TRIGGER audit_events_no_truncate
+BEFORE TRUNCATE ON audit_events
+FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
@@ -0,0 +1,5 @@
+DELETE FROM role_permissions
+WHERE permission IN ('webhooks:read', 'webhooks:write');
+
+DROP TABLE webhook_deliveries;
+DROP TABLE webhooks;
@@ -0,0 +1,65 @@
+-- Webhooks notify a URL of instance lifecycle events. A personal webhook
+-- fires for its user's instances, an organization webhook for the org's.
+CREATE TABLE webhooks (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    org_id UUID REFERENCES organizations(id) ON DELETE CASCADE,
+    CHECK ((user_id IS NULL) <> (org_id IS NULL)),
+
+    url TEXT NOT NULL,
+
+    -- signs each payload with HMAC-SHA256; unlike a token it is needed in
+    -- full to sign, so it is stored as is
+    secret TEXT NOT NULL,
+
+    -- space-separated event names, e.g. 'instance.started instance.stopped'
+    events TEXT NOT NULL,
+
+    enabled BOOLEAN NOT NULL DEFAULT true,
+
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_webhooks_user ON webhooks(user_id);
+CREATE INDEX idx_webhooks_org ON webhooks(org_id);
+
+-- The outbox: one row per event and webhook, written when the event happens
+-- and delivered by a background worker, which retries with backoff.
+CREATE TABLE webhook_deliveries (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    webhook_id UUID NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+
+    event TEXT NOT NULL,
+    payload JSONB NOT NULL,
+
+    -- pending | delivered | failed
+    status TEXT NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'delivered', 'failed')),
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_attempt_at TIMESTAMPTZ,
+
+    -- from the last attempt; response_status is NULL when the receiver was
+    -- never reached
+    response_status INT,
+    error TEXT NOT NULL DEFAULT '',
+
+    delivered_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at)
+WHERE status = 'pending';
+CREATE INDEX idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, created_at);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('user', 'webhooks:read'),
+    ('user', 'webhooks:write'),
+    ('instructor', 'webhooks:read'),
+    ('instructor', 'webhooks:write'),
+    ('org-admin', 'webhooks:read'),
+    ('org-admin', 'webhooks:write'),
+    ('platform-admin', 'webhooks:read'),
+    ('platform-admin', 'webhooks:write');
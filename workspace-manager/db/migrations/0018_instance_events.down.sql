@@ -0,0 +1,4 @@
+DROP TABLE instance_expiry_warnings;
+
+DROP TRIGGER instances_notify_status ON instances;
+DROP FUNCTION notify_instance_status();
@@ -0,0 +1,53 @@
+-- Instance events reach every manager replica through NOTIFY on the
+-- instance_events channel; each replica LISTENs and streams them to its
+-- clients. The payload is the JSON of events.Event.
+
+-- Status changes are published here rather than by the code making them,
+-- so none is missed whichever path or replica changes an instance. NOTIFY
+-- is sent when the transaction commits, so clients never see a change that
+-- was rolled back.
+CREATE FUNCTION notify_instance_status() RETURNS trigger AS $$
+DECLARE
+    inst instances;
+    old_status TEXT;
+    new_status TEXT;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        inst := NEW;
+        new_status := NEW.status;
+    ELSIF TG_OP = 'DELETE' THEN
+        inst := OLD;
+        old_status := OLD.status;
+        new_status := 'deleted';
+    ELSE
+        IF NEW.status IS NOT DISTINCT FROM OLD.status THEN
+            RETURN NULL;
+        END IF;
+        inst := NEW;
+        old_status := OLD.status;
+        new_status := NEW.status;
+    END IF;
+
+    PERFORM pg_notify('instance_events', json_build_object(
+        'type', 'status',
+        'instance_id', inst.id,
+        'user_id', inst.user_id,
+        'org_id', inst.org_id,
+        'status', new_status,
+        'previous', old_status,
+        'occurred_at', NOW()
+    )::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER instances_notify_status
+AFTER INSERT OR DELETE OR UPDATE OF status ON instances
+FOR EACH ROW EXECUTE FUNCTION notify_instance_status();
+
+-- Instances whose owners have been warned that the TTL is about to run
+-- out; claiming a row here is what stops two replicas warning twice.
+CREATE TABLE instance_expiry_warnings (
+    instance_id UUID PRIMARY KEY REFERENCES instances(id) ON DELETE CASCADE,
+    warned_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
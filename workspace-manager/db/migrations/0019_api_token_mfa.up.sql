@@ -0,0 +1,4 @@
+-- Whether the session a token was created in passed MFA; organizations
+-- requiring MFA only accept tokens that did.
+ALTER TABLE api_tokens
+ADD COLUMN mfa_verified BOOLEAN NOT NULL DEFAULT false;
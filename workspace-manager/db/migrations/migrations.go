@@ -0,0 +1,354 @@
+// Package migrations holds the numbered schema migrations and applies them.
+//
+// Each migration is a pair of files, NNNN_name.up.sql and NNNN_name.down.sql,
+// embedded in the binary. sqlc reads the same directory (skipping the down
+// files), so a schema change is made by adding a migration and regenerating.
+// Applied versions are recorded in schema_migrations.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// lockID is the advisory lock held while migrating, so two managers starting
+// at once do not both apply the same migration.
+const lockID = 7_341_902_116
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// State is a migration and, if it has been applied, when.
+type State struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// All returns the embedded migrations in version order.
+func All() ([]Migration, error) {
+	entries, err := fs.ReadDir(files, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		name := e.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		num, label, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: name must be NNNN_description", name)
+		}
+		version, err := strconv.ParseInt(num, 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: invalid version", name)
+		}
+
+		body, err := fs.ReadFile(files, name)
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		}
+		if m.Name != label {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, label)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	all := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		all = append(all, *m)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Version < all[j].Version })
+	return all, nil
+}
+
+// Latest is the version the embedded migrations bring the schema to.
+func Latest() (int64, error) {
+	all, err := All()
+	if err != nil || len(all) == 0 {
+		return 0, err
+	}
+	return all[len(all)-1].Version, nil
+}
+
+// Up applies every pending migration, each in its own transaction, and
+// returns the ones it applied.
+func Up(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	all, err := All()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	err = withLock(ctx, db, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range all {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			if err := apply(ctx, conn, m.Up, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx,
+					"INSERT INTO schema_migrations (version, name) VALUES ($1, $2)",
+					m.Version, m.Name)
+				return err
+			}); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down rolls back the n most recently applied migrations and returns them.
+func Down(ctx context.Context, db *sql.DB, n int) ([]Migration, error) {
+	all, err := All()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	err = withLock(ctx, db, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(all) - 1; i >= 0 && len(done) < n; i-- {
+			m := all[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			if m.Down == "" {
+				return fmt.Errorf("migration %d_%s cannot be rolled back", m.Version, m.Name)
+			}
+			if err := apply(ctx, conn, m.Down, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx,
+					"DELETE FROM schema_migrations WHERE version = $1", m.Version)
+				return err
+			}); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Force records the schema as being exactly at version without running any
+// SQL. It is for adopting a database that was set up by hand.
+func Force(ctx context.Context, db *sql.DB, version int64) error {
+	all, err := All()
+	if err != nil {
+		return err
+	}
+
+	known := version == 0
+	for _, m := range all {
+		known = known || m.Version == version
+	}
+	if !known {
+		return fmt.Errorf("unknown migration version %d", version)
+	}
+
+	return withLock(ctx, db, func(conn *sql.Conn) error {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations"); err != nil {
+			return err
+		}
+		for _, m := range all {
+			if m.Version > version {
+				break
+			}
+			if _, err := tx.ExecContext(ctx,
+				"INSERT INTO schema_migrations (version, name) VALUES ($1, $2)",
+				m.Version, m.Name); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+}
+
+// Status lists every embedded migration with when it was applied.
+func Status(ctx context.Context, db *sql.DB) ([]State, error) {
+	all, err := All()
+	if err != nil {
+		return nil, err
+	}
+
+	var states []State
+	err = withLock(ctx, db, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range all {
+			s := State{Migration: m}
+			if at, ok := applied[m.Version]; ok {
+				s.AppliedAt = &at
+			}
+			states = append(states, s)
+		}
+		return nil
+	})
+	return states, err
+}
+
+// Check returns an error unless every embedded migration has been applied.
+// It only reads, so it is safe to call on every start.
+func Check(ctx context.Context, db *sql.DB) error {
+	all, err := All()
+	if err != nil {
+		return err
+	}
+
+	var exists bool
+	if err := db.QueryRowContext(ctx,
+		"SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("database has no schema_migrations table; %d migrations pending", len(all))
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	applied := map[int64]bool{}
+	for rows.Next() {
+		var v int64
+		if err := rows.Scan(&v); err != nil {
+			return err
+		}
+		applied[v] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var pending []string
+	for _, m := range all {
+		if !applied[m.Version] {
+			pending = append(pending, fmt.Sprintf("%04d_%s", m.Version, m.Name))
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%d migrations pending: %s", len(pending), strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// withLock runs fn on a single connection holding the migration lock, after
+// making sure schema_migrations exists.
+func withLock(ctx context.Context, db *sql.DB, fn func(*sql.Conn) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockID)
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int64]time.Time{}
+	for rows.Next() {
+		var v int64
+		var at time.Time
+		if err := rows.Scan(&v, &at); err != nil {
+			return nil, err
+		}
+		applied[v] = at
+	}
+	return applied, rows.Err()
+}
+
+// apply runs a migration script and its bookkeeping in one transaction, so a
+// failed migration leaves neither behind.
+func apply(ctx context.Context, conn *sql.Conn, script string, record func(*sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if err := record(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
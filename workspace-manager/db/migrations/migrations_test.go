@@ -0,0 +1,101 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+func TestAll(t *testing.T) {
+	all, err := All()
+	if err != nil {
+		t.Fatalf("All: %v", err)
+	}
+	if len(all) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+
+	for i, m := range all {
+		// versions are numbered without gaps, so a missing file shows up here
+		if want := int64(i + 1); m.Version != want {
+			t.Errorf("migration %d_%s: version %d, want %d", m.Version, m.Name, m.Version, want)
+		}
+		if strings.TrimSpace(m.Up) == "" {
+			t.Errorf("migration %d_%s: empty up", m.Version, m.Name)
+		}
+		if strings.TrimSpace(m.Down) == "" {
+			t.Errorf("migration %d_%s: no down, so it cannot be rolled back", m.Version, m.Name)
+		}
+	}
+
+	latest, err := Latest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := all[len(all)-1].Version; latest != want {
+		t.Errorf("Latest() = %d, want %d", latest, want)
+	}
+}
+
+// TestUpDown applies every migration, rolls them all back and applies them
+// again, checking each down undoes its up. It needs TEST_DATABASE_URL to
+// point at a database it may wipe.
+func TestUpDown(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	all, err := All()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Down(ctx, db, len(all)); err != nil {
+		t.Fatalf("resetting: %v", err)
+	}
+
+	for _, step := range []string{"first up", "down", "second up"} {
+		var done []Migration
+		if step == "down" {
+			done, err = Down(ctx, db, len(all))
+		} else {
+			done, err = Up(ctx, db)
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", step, err)
+		}
+		if len(done) != len(all) {
+			t.Errorf("%s applied %d migrations, want %d", step, len(done), len(all))
+		}
+
+		err = Check(ctx, db)
+		if step == "down" && err == nil {
+			t.Error("Check passed with every migration rolled back")
+		}
+		if step != "down" && err != nil {
+			t.Errorf("Check after %s: %v", step, err)
+		}
+	}
+
+	states, err := Status(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range states {
+		if s.AppliedAt == nil {
+			t.Errorf("migration %d_%s not applied", s.Version, s.Name)
+		}
+	}
+}
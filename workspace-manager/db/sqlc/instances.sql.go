@@ -22,11 +22,12 @@ INSERT INTO instances (
     ttl_hours,
     console_url,
     aws_username,
-    aws_password
+    aws_password,
+    org_id
 ) VALUES (
-    $1, $2, $3, $4, $5, $6, $7, $8
+    $1, $2, $3, $4, $5, $6, $7, $8, $9
 )
-RETURNING id, user_id, type, status, efs_path, container_id, host_port, ttl_hours, last_active, created_at, console_url, aws_username, aws_password
+RETURNING id, user_id, type, status, efs_path, container_id, host_port, ttl_hours, last_active, created_at, console_url, aws_username, aws_password, org_id
 `
 
 type CreateInstanceParams struct {
@@ -38,6 +39,7 @@ type CreateInstanceParams struct {
 	ConsoleUrl  sql.NullString `json:"console_url"`
 	AwsUsername sql.NullString `json:"aws_username"`
 	AwsPassword sql.NullString `json:"aws_password"`
+	OrgID       uuid.NullUUID  `json:"org_id"`
 }
 
 func (q *Queries) CreateInstance(ctx context.Context, arg CreateInstanceParams) (Instances, error) {
@@ -50,6 +52,7 @@ func (q *Queries) CreateInstance(ctx context.Context, arg CreateInstanceParams)
 		arg.ConsoleUrl,
 		arg.AwsUsername,
 		arg.AwsPassword,
+		arg.OrgID,
 	)
 	var i Instances
 	err := row.Scan(
@@ -66,12 +69,13 @@ func (q *Queries) CreateInstance(ctx context.Context, arg CreateInstanceParams)
 		&i.ConsoleUrl,
 		&i.AwsUsername,
 		&i.AwsPassword,
+		&i.OrgID,
 	)
 	return i, err
 }
 
 const getInstanceByID = `-- name: GetInstanceByID :one
-SELECT id, user_id, type, status, efs_path, container_id, host_port, ttl_hours, last_active, created_at, console_url, aws_username, aws_password
+SELECT id, user_id, type, status, efs_path, container_id, host_port, ttl_hours, last_active, created_at, console_url, aws_username, aws_password, org_id
 FROM instances
 WHERE id = $1
 LIMIT 1
@@ -94,12 +98,13 @@ func (q *Queries) GetInstanceByID(ctx context.Context, id uuid.UUID) (Instances,
 		&i.ConsoleUrl,
 		&i.AwsUsername,
 		&i.AwsPassword,
+		&i.OrgID,
 	)
 	return i, err
 }
 
 const listExpiredInstances = `-- name: ListExpiredInstances :many
-SELECT id, user_id, type, status, efs_path, container_id, host_port, ttl_hours, last_active, created_at, console_url, aws_username, aws_password
+SELECT id, user_id, type, status, efs_path, container_id, host_port, ttl_hours, last_active, created_at, console_url, aws_username, aws_password, org_id
 FROM instances
 WHERE
     status = 'running'
@@ -133,6 +138,7 @@ func (q *Queries) ListExpiredInstances(ctx context.Context) ([]Instances, error)
 			&i.ConsoleUrl,
 			&i.AwsUsername,
 			&i.AwsPassword,
+			&i.OrgID,
 		); err != nil {
 			return nil, err
 		}
@@ -148,7 +154,7 @@ func (q *Queries) ListExpiredInstances(ctx context.Context) ([]Instances, error)
 }
 
 const listUserInstances = `-- name: ListUserInstances :many
-SELECT id, user_id, type, status, efs_path, container_id, host_port, ttl_hours, last_active, created_at, console_url, aws_username, aws_password
+SELECT id, user_id, type, status, efs_path, container_id, host_port, ttl_hours, last_active, created_at, console_url, aws_username, aws_password, org_id
 FROM instances
 WHERE user_id = $1
 ORDER BY created_at DESC
@@ -177,6 +183,7 @@ func (q *Queries) ListUserInstances(ctx context.Context, userID uuid.UUID) ([]In
 			&i.ConsoleUrl,
 			&i.AwsUsername,
 			&i.AwsPassword,
+			&i.OrgID,
 		); err != nil {
 			return nil, err
 		}
@@ -207,6 +214,29 @@ func (q *Queries) StopExpiredInstance(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const transferOrgInstances = `-- name: TransferOrgInstances :execrows
+UPDATE instances i
+SET user_id = (
+    SELECT m.user_id
+    FROM org_members m
+    WHERE m.org_id = i.org_id
+      AND m.role = 'admin'
+      AND m.user_id != $1
+    ORDER BY m.created_at
+    LIMIT 1
+)
+WHERE i.user_id = $1
+  AND i.org_id IS NOT NULL
+`
+
+func (q *Queries) TransferOrgInstances(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, transferOrgInstances, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const updateInstanceOnStart = `-- name: UpdateInstanceOnStart :one
 UPDATE instances
 SET
@@ -216,7 +246,7 @@ SET
     last_active = NOW()
 WHERE id = $1
   AND type != 'aws'
-RETURNING id, user_id, type, status, efs_path, container_id, host_port, ttl_hours, last_active, created_at, console_url, aws_username, aws_password
+RETURNING id, user_id, type, status, efs_path, container_id, host_port, ttl_hours, last_active, created_at, console_url, aws_username, aws_password, org_id
 `
 
 type UpdateInstanceOnStartParams struct {
@@ -242,6 +272,7 @@ func (q *Queries) UpdateInstanceOnStart(ctx context.Context, arg UpdateInstanceO
 		&i.ConsoleUrl,
 		&i.AwsUsername,
 		&i.AwsPassword,
+		&i.OrgID,
 	)
 	return i, err
 }
@@ -254,7 +285,7 @@ SET
     host_port = NULL,
     last_active = NOW()
 WHERE id = $1
-RETURNING id, user_id, type, status, efs_path, container_id, host_port, ttl_hours, last_active, created_at, console_url, aws_username, aws_password
+RETURNING id, user_id, type, status, efs_path, container_id, host_port, ttl_hours, last_active, created_at, console_url, aws_username, aws_password, org_id
 `
 
 type UpdateInstanceStatusParams struct {
@@ -279,6 +310,7 @@ func (q *Queries) UpdateInstanceStatus(ctx context.Context, arg UpdateInstanceSt
 		&i.ConsoleUrl,
 		&i.AwsUsername,
 		&i.AwsPassword,
+		&i.OrgID,
 	)
 	return i, err
 }
@@ -287,7 +319,7 @@ const updateLastActive = `-- name: UpdateLastActive :one
 UPDATE instances
 SET last_active = $2
 WHERE id = $1
-RETURNING id, user_id, type, status, efs_path, container_id, host_port, ttl_hours, last_active, created_at, console_url, aws_username, aws_password
+RETURNING id, user_id, type, status, efs_path, container_id, host_port, ttl_hours, last_active, created_at, console_url, aws_username, aws_password, org_id
 `
 
 type UpdateLastActiveParams struct {
@@ -312,6 +344,7 @@ func (q *Queries) UpdateLastActive(ctx context.Context, arg UpdateLastActivePara
 		&i.ConsoleUrl,
 		&i.AwsUsername,
 		&i.AwsPassword,
+		&i.OrgID,
 	)
 	return i, err
 }
@@ -6,11 +6,95 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type ApiTokens struct {
+	ID          uuid.UUID     `json:"id"`
+	UserID      uuid.UUID     `json:"user_id"`
+	OrgID       uuid.NullUUID `json:"org_id"`
+	Name        string        `json:"name"`
+	TokenHash   string        `json:"token_hash"`
+	Prefix      string        `json:"prefix"`
+	Scopes      string        `json:"scopes"`
+	ExpiresAt   time.Time     `json:"expires_at"`
+	LastUsedAt  sql.NullTime  `json:"last_used_at"`
+	RevokedAt   sql.NullTime  `json:"revoked_at"`
+	CreatedAt   time.Time     `json:"created_at"`
+	MfaVerified bool          `json:"mfa_verified"`
+}
+
+type AuditEvents struct {
+	ID            int64           `json:"id"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	ActorUserID   uuid.NullUUID   `json:"actor_user_id"`
+	Action        string          `json:"action"`
+	Target        string          `json:"target"`
+	Ip            string          `json:"ip"`
+	Metadata      json.RawMessage `json:"metadata"`
+	SubjectUserID uuid.NullUUID   `json:"subject_user_id"`
+	InstanceID    uuid.NullUUID   `json:"instance_id"`
+	RequestID     string          `json:"request_id"`
+}
+
+type DataExports struct {
+	ID          uuid.UUID     `json:"id"`
+	UserID      uuid.UUID     `json:"user_id"`
+	IncludeData bool          `json:"include_data"`
+	Status      string        `json:"status"`
+	Error       string        `json:"error"`
+	SizeBytes   sql.NullInt64 `json:"size_bytes"`
+	StartedAt   sql.NullTime  `json:"started_at"`
+	CompletedAt sql.NullTime  `json:"completed_at"`
+	ExpiresAt   sql.NullTime  `json:"expires_at"`
+	CreatedAt   time.Time     `json:"created_at"`
+}
+
+type EmailTokens struct {
+	TokenHash string       `json:"token_hash"`
+	UserID    uuid.UUID    `json:"user_id"`
+	Purpose   string       `json:"purpose"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	UsedAt    sql.NullTime `json:"used_at"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+type InstanceExpiryWarnings struct {
+	InstanceID uuid.UUID `json:"instance_id"`
+	WarnedAt   time.Time `json:"warned_at"`
+}
+
+type InstanceMembers struct {
+	InstanceID uuid.UUID     `json:"instance_id"`
+	UserID     uuid.UUID     `json:"user_id"`
+	Role       string        `json:"role"`
+	InvitedBy  uuid.NullUUID `json:"invited_by"`
+	CreatedAt  time.Time     `json:"created_at"`
+}
+
+type InstanceShareAccesses struct {
+	ID         int64         `json:"id"`
+	ShareID    uuid.UUID     `json:"share_id"`
+	UserID     uuid.NullUUID `json:"user_id"`
+	RemoteAddr string        `json:"remote_addr"`
+	UserAgent  string        `json:"user_agent"`
+	AccessedAt time.Time     `json:"accessed_at"`
+}
+
+type InstanceShares struct {
+	ID         uuid.UUID    `json:"id"`
+	InstanceID uuid.UUID    `json:"instance_id"`
+	CreatedBy  uuid.UUID    `json:"created_by"`
+	TokenHash  string       `json:"token_hash"`
+	Role       string       `json:"role"`
+	ExpiresAt  time.Time    `json:"expires_at"`
+	RevokedAt  sql.NullTime `json:"revoked_at"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
 type Instances struct {
 	ID          uuid.UUID      `json:"id"`
 	UserID      uuid.UUID      `json:"user_id"`
@@ -25,11 +109,155 @@ type Instances struct {
 	ConsoleUrl  sql.NullString `json:"console_url"`
 	AwsUsername sql.NullString `json:"aws_username"`
 	AwsPassword sql.NullString `json:"aws_password"`
+	OrgID       uuid.NullUUID  `json:"org_id"`
 }
 
-type Users struct {
-	ID        uuid.UUID `json:"id"`
+type LoginThrottles struct {
+	Key           string    `json:"key"`
+	Failures      int32     `json:"failures"`
+	LastFailureAt time.Time `json:"last_failure_at"`
+}
+
+type MfaChallenges struct {
+	TokenHash string        `json:"token_hash"`
+	UserID    uuid.UUID     `json:"user_id"`
+	OrgID     uuid.NullUUID `json:"org_id"`
+	Attempts  int32         `json:"attempts"`
+	ExpiresAt time.Time     `json:"expires_at"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+type MfaRecoveryCodes struct {
+	ID        int64        `json:"id"`
+	UserID    uuid.UUID    `json:"user_id"`
+	CodeHash  string       `json:"code_hash"`
+	UsedAt    sql.NullTime `json:"used_at"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+type OidcAuthRequests struct {
+	StateHash    string    `json:"state_hash"`
+	CodeVerifier string    `json:"code_verifier"`
+	Nonce        string    `json:"nonce"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type OrgMembers struct {
+	OrgID     uuid.UUID `json:"org_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Organizations struct {
+	ID                  uuid.UUID     `json:"id"`
+	Name                string        `json:"name"`
+	MaxInstances        sql.NullInt32 `json:"max_instances"`
+	MaxRunningInstances sql.NullInt32 `json:"max_running_instances"`
+	CreatedAt           time.Time     `json:"created_at"`
+	RequireMfa          bool          `json:"require_mfa"`
+}
+
+type RefreshTokens struct {
+	TokenHash string       `json:"token_hash"`
+	SessionID uuid.UUID    `json:"session_id"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	UsedAt    sql.NullTime `json:"used_at"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+type RolePermissions struct {
+	Role       string `json:"role"`
+	Permission string `json:"permission"`
+}
+
+type Roles struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type Sessions struct {
+	ID          uuid.UUID     `json:"id"`
+	UserID      uuid.UUID     `json:"user_id"`
+	OrgID       uuid.NullUUID `json:"org_id"`
+	RevokedAt   sql.NullTime  `json:"revoked_at"`
+	CreatedAt   time.Time     `json:"created_at"`
+	MfaVerified bool          `json:"mfa_verified"`
+}
+
+type SignupInvites struct {
+	ID        uuid.UUID      `json:"id"`
+	CodeHash  string         `json:"code_hash"`
+	Email     sql.NullString `json:"email"`
+	MaxUses   int32          `json:"max_uses"`
+	Uses      int32          `json:"uses"`
+	CreatedBy uuid.NullUUID  `json:"created_by"`
+	ExpiresAt time.Time      `json:"expires_at"`
+	RevokedAt sql.NullTime   `json:"revoked_at"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+type UserIdentities struct {
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	UserID    uuid.UUID `json:"user_id"`
 	Email     string    `json:"email"`
-	Password  string    `json:"password"`
 	CreatedAt time.Time `json:"created_at"`
 }
+
+type UserMfa struct {
+	UserID       uuid.UUID    `json:"user_id"`
+	Secret       string       `json:"secret"`
+	LastUsedStep int64        `json:"last_used_step"`
+	EnabledAt    sql.NullTime `json:"enabled_at"`
+	CreatedAt    time.Time    `json:"created_at"`
+}
+
+type UserProfiles struct {
+	UserID              uuid.UUID      `json:"user_id"`
+	DisplayName         string         `json:"display_name"`
+	AvatarUrl           string         `json:"avatar_url"`
+	Timezone            string         `json:"timezone"`
+	DefaultInstanceType sql.NullString `json:"default_instance_type"`
+	DefaultTtlHours     sql.NullInt32  `json:"default_ttl_hours"`
+	UpdatedAt           time.Time      `json:"updated_at"`
+}
+
+type Users struct {
+	ID              uuid.UUID    `json:"id"`
+	Email           string       `json:"email"`
+	Password        string       `json:"password"`
+	CreatedAt       time.Time    `json:"created_at"`
+	DisabledAt      sql.NullTime `json:"disabled_at"`
+	Role            string       `json:"role"`
+	EmailVerifiedAt sql.NullTime `json:"email_verified_at"`
+}
+
+type WebhookDeliveries struct {
+	ID             uuid.UUID       `json:"id"`
+	WebhookID      uuid.UUID       `json:"webhook_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastAttemptAt  sql.NullTime    `json:"last_attempt_at"`
+	ResponseStatus sql.NullInt32   `json:"response_status"`
+	Error          string          `json:"error"`
+	DeliveredAt    sql.NullTime    `json:"delivered_at"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+type Webhooks struct {
+	ID        uuid.UUID     `json:"id"`
+	UserID    uuid.NullUUID `json:"user_id"`
+	OrgID     uuid.NullUUID `json:"org_id"`
+	Url       string        `json:"url"`
+	Secret    string        `json:"secret"`
+	Events    string        `json:"events"`
+	Enabled   bool          `json:"enabled"`
+	CreatedBy uuid.NullUUID `json:"created_by"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
@@ -14,7 +14,7 @@ import (
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (email, password)
 VALUES ($1, $2)
-RETURNING id, email, password, created_at
+RETURNING id, email, password, created_at, disabled_at, role, email_verified_at
 `
 
 type CreateUserParams struct {
@@ -30,14 +30,27 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (Users,
 		&i.Email,
 		&i.Password,
 		&i.CreatedAt,
+		&i.DisabledAt,
+		&i.Role,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
+const deleteUser = `-- name: DeleteUser :exec
+DELETE FROM users
+WHERE id = $1
+`
+
+func (q *Queries) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteUser, id)
+	return err
+}
+
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, email, password, created_at
+SELECT id, email, password, created_at, disabled_at, role, email_verified_at
 FROM users
-WHERE email = $1
+WHERE lower(email) = lower($1)
 LIMIT 1
 `
 
@@ -49,12 +62,15 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (Users, erro
 		&i.Email,
 		&i.Password,
 		&i.CreatedAt,
+		&i.DisabledAt,
+		&i.Role,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
 const getUserByID = `-- name: GetUserByID :one
-SELECT id, email, password, created_at
+SELECT id, email, password, created_at, disabled_at, role, email_verified_at
 FROM users
 WHERE id = $1
 LIMIT 1
@@ -68,6 +84,36 @@ func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (Users, error)
 		&i.Email,
 		&i.Password,
 		&i.CreatedAt,
+		&i.DisabledAt,
+		&i.Role,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
+
+const markEmailVerified = `-- name: MarkEmailVerified :exec
+UPDATE users
+SET email_verified_at = COALESCE(email_verified_at, NOW())
+WHERE id = $1
+`
+
+func (q *Queries) MarkEmailVerified(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, markEmailVerified, id)
+	return err
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users
+SET password = $2
+WHERE id = $1
+`
+
+type UpdateUserPasswordParams struct {
+	ID       uuid.UUID `json:"id"`
+	Password string    `json:"password"`
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.ID, arg.Password)
+	return err
+}
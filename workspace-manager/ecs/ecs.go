@@ -10,8 +10,16 @@ import (
     "github.com/aws/aws-sdk-go-v2/service/ec2"
     "github.com/aws/aws-sdk-go-v2/service/ecs"
     "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/trace"
+
+    "example.com/m/v2/internal/metrics"
+    "example.com/m/v2/internal/tracing"
 )
 
+const tracerName = "example.com/m/v2/ecs"
+
 type ECSManager struct {
     ecsClient *ecs.Client
     ec2Client *ec2.Client
@@ -25,27 +33,40 @@ type ECSManager struct {
     SecurityGroups []string
 }
 
-func NewECSManager() (*ECSManager, error) {
-    cfg, err := config.LoadDefaultConfig(context.Background())
+// Config names the cluster, task definitions and network workspaces run in.
+type Config struct {
+    Region         string // defaults to the SDK's usual lookup
+    Cluster        string
+    VscodeTaskDef  string
+    JupyterTaskDef string
+    MysqlTaskDef   string
+    SubnetIDs      []string
+    SecurityGroups []string
+}
+
+func NewECSManager(c Config) (*ECSManager, error) {
+    var opts []func(*config.LoadOptions) error
+    if c.Region != "" {
+        opts = append(opts, config.WithRegion(c.Region))
+    }
+
+    cfg, err := config.LoadDefaultConfig(context.Background(), opts...)
     if err != nil {
         return nil, err
     }
+    cfg.APIOptions = append(cfg.APIOptions, tracing.AWS)
 
     return &ECSManager{
         ecsClient:      ecs.NewFromConfig(cfg),
         ec2Client:      ec2.NewFromConfig(cfg),
-        Cluster:        "ambilio-cluster",
+        Cluster:        c.Cluster,
 
-        VscodeTaskDef:  "vscode_embedded",
-        JupyterTaskDef: "jupyter_embedded",
-        MysqlTaskDef:   "mysql_embedded", 
+        VscodeTaskDef:  c.VscodeTaskDef,
+        JupyterTaskDef: c.JupyterTaskDef,
+        MysqlTaskDef:   c.MysqlTaskDef,
 
-        SubnetIDs: []string{
-            "subnet-08a2ed4baa1a627f8",
-        },
-        SecurityGroups: []string{
-            "sg-0fcec6ae1b628b075",
-        },
+        SubnetIDs:      c.SubnetIDs,
+        SecurityGroups: c.SecurityGroups,
     }, nil
 }
 
@@ -57,6 +78,19 @@ func (m *ECSManager) RunWorkspaceTask(
     workspaceType string,
 ) (taskArn string, privateIP string, err error) {
 
+    defer func(start time.Time) {
+        metrics.ObserveOperation("ecs", "start", workspaceType, start, err)
+    }(time.Now())
+
+    ctx, span := tracing.Start(ctx, tracerName, "ecs.start",
+        attribute.String("instance.id", instanceID),
+        attribute.String("workspace.type", workspaceType),
+    )
+    defer func() {
+        span.SetAttributes(attribute.String("ecs.task_arn", taskArn))
+        tracing.End(span, err)
+    }()
+
     var taskDef string
     var containerName string
 
@@ -118,6 +152,7 @@ func (m *ECSManager) RunWorkspaceTask(
     var eniID string
 
     for i := 0; i < 10; i++ {
+        span.AddEvent("waiting for ENI", trace.WithAttributes(attribute.Int("attempt", i+1)))
         desc, err := m.ecsClient.DescribeTasks(ctx, &ecs.DescribeTasksInput{
             Cluster: aws.String(m.Cluster),
             Tasks:   []string{taskArn},
@@ -157,11 +192,34 @@ func (m *ECSManager) RunWorkspaceTask(
     return taskArn, privateIP, nil
 }
 
-func (m *ECSManager) StopTask(ctx context.Context, taskArn string) error {
-    _, err := m.ecsClient.StopTask(ctx, &ecs.StopTaskInput{
+func (m *ECSManager) StopTask(ctx context.Context, taskArn string) (err error) {
+    // the task ARN does not say which workspace type it ran
+    defer func(start time.Time) {
+        metrics.ObserveOperation("ecs", "stop", "", start, err)
+    }(time.Now())
+
+    ctx, span := tracing.Start(ctx, tracerName, "ecs.stop", attribute.String("ecs.task_arn", taskArn))
+    defer func() { tracing.End(span, err) }()
+
+    _, err = m.ecsClient.StopTask(ctx, &ecs.StopTaskInput{
         Cluster: aws.String(m.Cluster),
         Task:    aws.String(taskArn),
         Reason:  aws.String("Stopped by user"),
     })
     return err
 }
+
+// Ping checks that the ECS API answers and the cluster is active.
+func (m *ECSManager) Ping(ctx context.Context) error {
+    resp, err := m.ecsClient.DescribeClusters(ctx, &ecs.DescribeClustersInput{
+        Clusters: []string{m.Cluster},
+    })
+    if err != nil {
+        return err
+    }
+
+    if len(resp.Clusters) == 0 || aws.ToString(resp.Clusters[0].Status) != "ACTIVE" {
+        return errors.New("cluster " + m.Cluster + " is not active")
+    }
+    return nil
+}
@@ -4,23 +4,46 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+
+	"example.com/m/v2/internal/tracing"
 )
 
+// AWSConfig locates the account sandbox users are created in.
+type AWSConfig struct {
+	Region            string // defaults to the SDK's usual lookup
+	AccountID         string
+	BoundaryPolicyARN string // permissions boundary attached to every sandbox user
+}
+
+// ErrAWSNotConfigured is returned when no sandbox account is configured.
+var ErrAWSNotConfigured = errors.New("aws sandboxes are not configured")
+
 type AWSService struct {
 	iam *iam.Client
+	cfg AWSConfig
 }
 
-func NewAWSService() (*AWSService, error) {
-	cfg, err := config.LoadDefaultConfig(context.Background())
+func NewAWSService(c AWSConfig) (*AWSService, error) {
+	var opts []func(*config.LoadOptions) error
+	if c.Region != "" {
+		opts = append(opts, config.WithRegion(c.Region))
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.Background(), opts...)
 	if err != nil {
 		return nil, err
 	}
+	cfg.APIOptions = append(cfg.APIOptions, tracing.AWS)
+
 	return &AWSService{
 		iam: iam.NewFromConfig(cfg),
+		cfg: c,
 	}, nil
 }
 
@@ -30,13 +53,16 @@ func (a *AWSService) CreateSandboxUser(
 	instanceID string,
 ) (username, password, consoleURL string, err error) {
 
+	if a.cfg.AccountID == "" {
+		err = ErrAWSNotConfigured
+		return
+	}
+
 	username = "ambilio-" + instanceID
 
 	_, err = a.iam.CreateUser(ctx, &iam.CreateUserInput{
 		UserName: aws.String(username),
-		PermissionsBoundary: aws.String(
-			"arn:aws:iam::921646896924:policy/ambilio-sandbox-boundary",
-		),
+		PermissionsBoundary: aws.String(a.cfg.BoundaryPolicyARN),
 	})
 	if err != nil {
 		return
@@ -53,11 +79,31 @@ func (a *AWSService) CreateSandboxUser(
 		return
 	}
 
-	consoleURL = "https://921646896924.signin.aws.amazon.com/console"
+	consoleURL = "https://" + a.cfg.AccountID + ".signin.aws.amazon.com/console"
 	return
 }
 
+// DeleteSandboxUser removes a user created by CreateSandboxUser. Missing
+// users and login profiles are not an error.
+func (a *AWSService) DeleteSandboxUser(ctx context.Context, username string) error {
+	var notFound *types.NoSuchEntityException
 
+	_, err := a.iam.DeleteLoginProfile(ctx, &iam.DeleteLoginProfileInput{
+		UserName: aws.String(username),
+	})
+	if err != nil && !errors.As(err, &notFound) {
+		return err
+	}
+
+	_, err = a.iam.DeleteUser(ctx, &iam.DeleteUserInput{
+		UserName: aws.String(username),
+	})
+	if err != nil && !errors.As(err, &notFound) {
+		return err
+	}
+
+	return nil
+}
 
 
 func generatePassword() string {
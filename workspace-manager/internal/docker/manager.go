@@ -2,12 +2,44 @@ package docker
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os/exec"
 	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"example.com/m/v2/internal/metrics"
+	"example.com/m/v2/internal/tracing"
+)
+
+const tracerName = "example.com/m/v2/internal/docker"
+
+// Steps of starting a workspace, reported through WithProgress.
+const (
+	StepPullingImage      = "pulling_image"
+	StepStartingContainer = "starting_container"
+	StepHealthCheckPassed = "health_check_passed"
 )
 
+// HealthTimeout bounds how long Run waits for new containers to come up.
+const HealthTimeout = time.Minute
+
+type progressKey struct{}
+
+// WithProgress returns a context under which Run tells fn about each step
+// of starting a workspace.
+func WithProgress(ctx context.Context, fn func(step string)) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+func progress(ctx context.Context, step string) {
+	if fn, ok := ctx.Value(progressKey{}).(func(string)); ok {
+		fn(step)
+	}
+}
+
 type DockerManager struct{}
 
 func NewDockerManager() *DockerManager {
@@ -26,7 +58,17 @@ func (d *DockerManager) Run(
 	instanceID string,
 	workspaceType string,
 	dataPath string,
-) (*RunResult, error) {
+) (res *RunResult, err error) {
+
+	defer func(start time.Time) {
+		metrics.ObserveOperation("docker", "start", workspaceType, start, err)
+	}(time.Now())
+
+	ctx, span := tracing.Start(ctx, tracerName, "docker.start",
+		attribute.String("instance.id", instanceID),
+		attribute.String("workspace.type", workspaceType),
+	)
+	defer func() { tracing.End(span, err) }()
 
 	switch workspaceType {
 
@@ -62,26 +104,32 @@ func (d *DockerManager) runSingle(
 
 	name := "ws_" + instanceID
 
-	cmd := exec.CommandContext(
-		ctx,
-		"docker", "run", "-d",
+	if err := d.ensureImage(ctx, image); err != nil {
+		return nil, err
+	}
+	progress(ctx, StepStartingContainer)
+
+	out, err := d.docker(ctx, name,
+		"run", "-d",
 		"--name", name,
 		"-p", "0:"+port,
 		"--restart", "unless-stopped",
 		"-v", dataPath+":/data",
 		image,
 	)
-
-	out, err := cmd.CombinedOutput()
 	if err != nil {
 		return nil, fmt.Errorf("docker run failed: %s", out)
 	}
 
-	hostPort, err := d.lookupPort(name, port)
+	hostPort, err := d.lookupPort(ctx, name, port)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := d.waitHealthy(ctx, name); err != nil {
+		return nil, err
+	}
+
 	return &RunResult{
 		ContainerID: strings.TrimSpace(string(out)),
 		HostPort:    hostPort,
@@ -98,9 +146,13 @@ func (d *DockerManager) runMySQL(
 	mysqlName := "ws_mysql_" + instanceID
 	adminerName := "ws_mysql_adminer_" + instanceID
 
-	mysqlCmd := exec.CommandContext(
-		ctx,
-		"docker", "run", "-d",
+	if err := d.ensureImage(ctx, "mysql:8.0", "adminer"); err != nil {
+		return nil, err
+	}
+	progress(ctx, StepStartingContainer)
+
+	if out, err := d.docker(ctx, mysqlName,
+		"run", "-d",
 		"--name", mysqlName,
 		"--network", "ambilio_net",
 		"--restart", "unless-stopped",
@@ -108,31 +160,30 @@ func (d *DockerManager) runMySQL(
 		"-e", "MYSQL_DATABASE=workspace",
 		"-v", dataPath+"/mysql:/var/lib/mysql",
 		"mysql:8.0",
-	)
-
-	if out, err := mysqlCmd.CombinedOutput(); err != nil {
+	); err != nil {
 		return nil, fmt.Errorf("mysql run failed: %s", out)
 	}
 
-	adminerCmd := exec.CommandContext(
-		ctx,
-		"docker", "run", "-d",
+	if out, err := d.docker(ctx, adminerName,
+		"run", "-d",
 		"--name", adminerName,
 		"--network", "ambilio_net",
 		"-p", "0:8080",
 		"--restart", "unless-stopped",
 		"adminer",
-	)
-
-	if out, err := adminerCmd.CombinedOutput(); err != nil {
+	); err != nil {
 		return nil, fmt.Errorf("adminer run failed: %s", out)
 	}
 
-	hostPort, err := d.lookupPort(adminerName, "8080")
+	hostPort, err := d.lookupPort(ctx, adminerName, "8080")
 	if err != nil {
 		return nil, err
 	}
 
+	if err := d.waitHealthy(ctx, mysqlName, adminerName); err != nil {
+		return nil, err
+	}
+
 	return &RunResult{
 		ContainerID: mysqlName,
 		HostPort:    hostPort,
@@ -148,9 +199,13 @@ func (d *DockerManager) runWeaviate(
 	weaviateName := "ws_weaviate_" + instanceID
 	consoleName := "ws_weaviate_console_" + instanceID
 
-	weaviateCmd := exec.CommandContext(
-		ctx,
-		"docker", "run", "-d",
+	if err := d.ensureImage(ctx, "semitechnologies/weaviate:1.24.4", "semitechnologies/weaviate-console"); err != nil {
+		return nil, err
+	}
+	progress(ctx, StepStartingContainer)
+
+	if out, err := d.docker(ctx, weaviateName,
+		"run", "-d",
 		"--name", weaviateName,
 		"--network", "ambilio_net",
 		"--restart", "unless-stopped",
@@ -165,32 +220,31 @@ func (d *DockerManager) runWeaviate(
 		"-e", "CLUSTER_HOSTNAME="+weaviateName,
 
 		"semitechnologies/weaviate:1.24.4",
-	)
-
-	if out, err := weaviateCmd.CombinedOutput(); err != nil {
+	); err != nil {
 		return nil, fmt.Errorf("weaviate run failed: %s", out)
 	}
 
-	consoleCmd := exec.CommandContext(
-		ctx,
-		"docker", "run", "-d",
+	if out, err := d.docker(ctx, consoleName,
+		"run", "-d",
 		"--name", consoleName,
 		"--network", "ambilio_net",
 		"-p", "0:80", 
 		"--restart", "unless-stopped",
 		"-e", "WEAVIATE_URL=http://"+weaviateName+":8080",
 		"semitechnologies/weaviate-console",
-	)
-
-	if out, err := consoleCmd.CombinedOutput(); err != nil {
+	); err != nil {
 		return nil, fmt.Errorf("weaviate console run failed: %s", out)
 	}
 
-	hostPort, err := d.lookupPort(consoleName, "80") 
+	hostPort, err := d.lookupPort(ctx, consoleName, "80") 
 	if err != nil {
 		return nil, err
 	}
 
+	if err := d.waitHealthy(ctx, weaviateName, consoleName); err != nil {
+		return nil, err
+	}
+
 	return &RunResult{
 		ContainerID: consoleName,
 		HostPort:    hostPort,
@@ -199,9 +253,8 @@ func (d *DockerManager) runWeaviate(
 
 
 
-func (d *DockerManager) lookupPort(container, port string) (string, error) {
-	cmd := exec.Command("docker", "port", container, port)
-	out, err := cmd.CombinedOutput()
+func (d *DockerManager) lookupPort(ctx context.Context, container, port string) (string, error) {
+	out, err := d.docker(ctx, container, "port", container, port)
 	if err != nil {
 		return "", fmt.Errorf("port lookup failed: %s", out)
 	}
@@ -210,10 +263,164 @@ func (d *DockerManager) lookupPort(container, port string) (string, error) {
 	return parts[len(parts)-1], nil
 }
 
-func (d *DockerManager) Stop(instanceID, workspaceType string) {
-	exec.Command("docker", "rm", "-f", "ws_"+instanceID).Run()
-	exec.Command("docker", "rm", "-f", "ws_mysql_"+instanceID).Run()
-	exec.Command("docker", "rm", "-f", "ws_mysql_adminer_"+instanceID).Run()
-	exec.Command("docker", "rm", "-f", "ws_weaviate_"+instanceID).Run()
-	exec.Command("docker", "rm", "-f", "ws_weaviate_console_"+instanceID).Run()
+// ensureImage pulls the images the host does not have yet. docker run would
+// pull them anyway; pulling first lets the wait be reported.
+func (d *DockerManager) ensureImage(ctx context.Context, images ...string) error {
+	for _, image := range images {
+		if _, err := d.docker(ctx, "", "image", "inspect", "--format", "{{.Id}}", image); err == nil {
+			continue
+		}
+
+		progress(ctx, StepPullingImage)
+		if out, err := d.docker(ctx, "", "pull", image); err != nil {
+			return fmt.Errorf("docker pull failed: %s", out)
+		}
+	}
+	return nil
+}
+
+// waitHealthy waits for the containers to be running and, when their image
+// defines a HEALTHCHECK, healthy. A container that exits or turns unhealthy
+// is an error. One still starting after HealthTimeout is not, since slow
+// images get there in the end; only the progress step is left out.
+func (d *DockerManager) waitHealthy(ctx context.Context, containers ...string) error {
+	deadline := time.Now().Add(HealthTimeout)
+
+	for _, name := range containers {
+		for {
+			out, err := d.docker(ctx, name,
+				"inspect",
+				"--format", "{{.State.Status}} {{if .State.Health}}{{.State.Health.Status}}{{end}}",
+				name,
+			)
+			if err != nil {
+				return fmt.Errorf("docker inspect failed: %s", out)
+			}
+
+			state, health, _ := strings.Cut(strings.TrimSpace(string(out)), " ")
+			if state == "exited" || state == "dead" {
+				return fmt.Errorf("container %s %s while starting", name, state)
+			}
+			if health == "unhealthy" {
+				return fmt.Errorf("container %s is unhealthy", name)
+			}
+			if state == "running" && (health == "" || health == "healthy") {
+				break
+			}
+
+			if time.Now().After(deadline) {
+				return nil
+			}
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+
+	progress(ctx, StepHealthCheckPassed)
+	return nil
+}
+
+// Stop removes every container the instance may have. ctx only carries the
+// trace; the containers are removed even if it is cancelled.
+func (d *DockerManager) Stop(ctx context.Context, instanceID, workspaceType string) (err error) {
+	defer func(start time.Time) {
+		metrics.ObserveOperation("docker", "stop", workspaceType, start, err)
+	}(time.Now())
+
+	ctx, span := tracing.Start(context.WithoutCancel(ctx), tracerName, "docker.stop",
+		attribute.String("instance.id", instanceID),
+		attribute.String("workspace.type", workspaceType),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	var errs []error
+	for _, name := range []string{
+		"ws_" + instanceID,
+		"ws_mysql_" + instanceID,
+		"ws_mysql_adminer_" + instanceID,
+		"ws_weaviate_" + instanceID,
+		"ws_weaviate_console_" + instanceID,
+	} {
+		// a type only has some of these, so missing ones are expected
+		out, err := d.docker(ctx, name, "rm", "-f", name)
+		if err != nil && !strings.Contains(string(out), "No such container") {
+			errs = append(errs, fmt.Errorf("docker rm %s failed: %s", name, strings.TrimSpace(string(out))))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// docker runs one docker CLI command under its own span, named after the
+// subcommand, so a slow image pull or port lookup stands out in a trace.
+// container is recorded on the span when the command is about one.
+func (d *DockerManager) docker(ctx context.Context, container string, args ...string) ([]byte, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "docker "+args[0])
+	if container != "" {
+		span.SetAttributes(attribute.String("docker.container", container))
+	}
+
+	out, err := exec.CommandContext(ctx, "docker", args...).CombinedOutput()
+	tracing.End(span, err)
+	return out, err
+}
+
+// Container is a workspace container on the host.
+type Container struct {
+	Name      string
+	CreatedAt time.Time
+}
+
+// dockerTimeLayout is how docker ps formats {{.CreatedAt}}.
+const dockerTimeLayout = "2006-01-02 15:04:05 -0700 MST"
+
+// ListWorkspaceContainers returns all workspace containers on the host,
+// running or not.
+func (d *DockerManager) ListWorkspaceContainers(ctx context.Context) ([]Container, error) {
+	out, err := d.docker(ctx, "",
+		"ps", "-a",
+		"--filter", "name=ws_",
+		"--format", "{{.Names}}\t{{.CreatedAt}}",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("docker ps failed: %s", out)
+	}
+
+	return parseContainers(string(out))
+}
+
+// parseContainers reads docker ps output formatted as name, tab, creation
+// time.
+func parseContainers(out string) ([]Container, error) {
+	var containers []Container
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if line == "" {
+			continue
+		}
+		name, created, _ := strings.Cut(line, "\t")
+		createdAt, err := time.Parse(dockerTimeLayout, created)
+		if err != nil {
+			return nil, fmt.Errorf("docker ps: container %s: %w", name, err)
+		}
+		containers = append(containers, Container{Name: name, CreatedAt: createdAt})
+	}
+	return containers, nil
+}
+
+// Ping checks that the Docker daemon answers.
+func (d *DockerManager) Ping(ctx context.Context) error {
+	out, err := d.docker(ctx, "",
+		"version",
+		"--format", "{{.Server.Version}}",
+	)
+	if err != nil {
+		msg := strings.TrimSpace(string(out))
+		if msg == "" {
+			msg = err.Error()
+		}
+		return fmt.Errorf("docker version failed: %s", msg)
+	}
+	return nil
 }
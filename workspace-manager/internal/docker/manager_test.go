@@ -0,0 +1,120 @@
+package docker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"example.com/m/v2/internal/metrics"
+)
+
+func TestParseContainers(t *testing.T) {
+	out := "ws_a\t2025-03-04 10:11:12 +0000 UTC\n" +
+		"ws_mysql_b\t2025-03-04 12:00:00 +0100 CET\n"
+
+	got, err := parseContainers(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Container{
+		{Name: "ws_a", CreatedAt: time.Date(2025, 3, 4, 10, 11, 12, 0, time.UTC)},
+		{Name: "ws_mysql_b", CreatedAt: time.Date(2025, 3, 4, 11, 0, 0, 0, time.UTC)},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("parseContainers = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i].Name != want[i].Name || !got[i].CreatedAt.Equal(want[i].CreatedAt) {
+			t.Errorf("container %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseContainersErrors(t *testing.T) {
+	tests := []struct {
+		name, out string
+		wantErr   bool
+		want      int
+	}{
+		{"empty", "", false, 0},
+		{"blank lines", "\n\n", false, 0},
+		{"no time", "ws_a", true, 0},
+		{"bad time", "ws_a\tyesterday", true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseContainers(tt.out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if len(got) != tt.want {
+				t.Errorf("parseContainers = %v, want %d containers", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeDocker puts a docker command running script first on PATH.
+func fakeDocker(t *testing.T, script string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "docker"), []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestStop(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		wantErr string
+	}{
+		{
+			name:   "removed",
+			script: `case "$3" in ws_mysql_[!a]*) echo "$3";; *) echo "Error response from daemon: No such container: $3" >&2; exit 1;; esac`,
+		},
+		{
+			name:   "none left",
+			script: `echo "Error response from daemon: No such container: $3" >&2; exit 1`,
+		},
+		{
+			name:    "rm fails",
+			script:  `case "$3" in ws_mysql_[!a]*) echo "Error response from daemon: cannot remove container: permission denied" >&2; exit 1;; *) exit 0;; esac`,
+			wantErr: "permission denied",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeDocker(t, tt.script)
+			failures := metrics.WorkspaceOperationFailures.WithLabelValues("docker", "stop", "mysql")
+			before := testutil.ToFloat64(failures)
+
+			err := NewDockerManager().Stop(context.Background(), "11111111-1111-1111-1111-111111111111", "mysql")
+
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Stop: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Stop = %v, want an error containing %q", err, tt.wantErr)
+			}
+
+			want := before
+			if tt.wantErr != "" {
+				want++
+			}
+			if got := testutil.ToFloat64(failures); got != want {
+				t.Errorf("stop failures = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind by
+// before it is dropped.
+const subscriberBuffer = 64
+
+// Broker listens for events on its own database connection and fans them
+// out to subscribers.
+//
+// A subscriber that falls too far behind, or that was subscribed while the
+// connection dropped and events may have been missed, has its channel
+// closed. It is expected to subscribe again and reload what it shows.
+type Broker struct {
+	dsn string
+
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+func NewBroker(dsn string) *Broker {
+	return &Broker{dsn: dsn, subs: map[chan Event]struct{}{}}
+}
+
+// Subscribe returns a channel of every event, and the function to call when
+// done with it.
+func (b *Broker) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() { b.drop(ch) }
+}
+
+func (b *Broker) drop(ch chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[ch]; ok {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+func (b *Broker) dropAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+func (b *Broker) publish(ev Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Start listens until ctx is done, reconnecting with backoff. Subscribers
+// are dropped when it stops, so open streams end and do not hold up a
+// graceful shutdown.
+func (b *Broker) Start(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer b.dropAll()
+
+		backoff := time.Second
+		for {
+			started := time.Now()
+			err := b.listen(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			// whatever arrived while reconnecting is lost
+			b.dropAll()
+
+			if time.Since(started) > time.Minute {
+				backoff = time.Second
+			}
+			slog.ErrorContext(ctx, "listening for instance events failed", "error", err, "retry_in", backoff.String())
+
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return
+			}
+			backoff = min(backoff*2, 30*time.Second)
+		}
+	}()
+}
+
+func (b *Broker) listen(ctx context.Context) error {
+	conn, err := pgx.Connect(ctx, b.dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.WithoutCancel(ctx))
+
+	if _, err := conn.Exec(ctx, "LISTEN "+Channel); err != nil {
+		return err
+	}
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var ev Event
+		if err := json.Unmarshal([]byte(n.Payload), &ev); err != nil {
+			slog.WarnContext(ctx, "ignoring malformed instance event", "error", err)
+			continue
+		}
+		b.publish(ev)
+	}
+}
@@ -0,0 +1,76 @@
+// Package events carries instance events between manager replicas. Events
+// are published with Postgres NOTIFY on the instance_events channel, and a
+// Broker on each replica LISTENs and hands them to local subscribers, such
+// as the dashboard's event stream.
+//
+// Status changes are published by a trigger on the instances table (see
+// migration 0018); the manager publishes start progress and expiry
+// warnings itself.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	db "example.com/m/v2/db/sqlc"
+)
+
+// Channel is the NOTIFY channel events travel on.
+const Channel = "instance_events"
+
+// Event types.
+const (
+	TypeStatus        = "status"         // Status changed from Previous; "deleted" once gone
+	TypeProgress      = "progress"       // a start reached Step
+	TypeExpiryWarning = "expiry_warning" // the TTL runs out at ExpiresAt
+)
+
+// Event is one instance event. Which of the optional fields are set depends
+// on Type.
+type Event struct {
+	Type       string     `json:"type"`
+	InstanceID uuid.UUID  `json:"instance_id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	OrgID      *uuid.UUID `json:"org_id,omitempty"`
+	Status     string     `json:"status,omitempty"`
+	Previous   string     `json:"previous,omitempty"`
+	Step       string     `json:"step,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	OccurredAt time.Time  `json:"occurred_at"`
+}
+
+// Progress is the event for a start of inst reaching step.
+func Progress(inst db.Instances, step string) Event {
+	ev := Event{
+		Type:       TypeProgress,
+		InstanceID: inst.ID,
+		UserID:     inst.UserID,
+		Step:       step,
+	}
+	if inst.OrgID.Valid {
+		ev.OrgID = &inst.OrgID.UUID
+	}
+	return ev
+}
+
+// Publish sends ev to every replica. Failures are logged rather than
+// returned: events are advisory, and clients catch up from the snapshot
+// they get on reconnecting.
+func Publish(ctx context.Context, q *db.Queries, ev Event) {
+	if ev.OccurredAt.IsZero() {
+		ev.OccurredAt = time.Now().UTC()
+	}
+
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		slog.ErrorContext(ctx, "encoding instance event failed", "type", ev.Type, "error", err)
+		return
+	}
+	if err := q.NotifyInstanceEvent(ctx, string(payload)); err != nil {
+		slog.ErrorContext(ctx, "publishing instance event failed", "type", ev.Type, "error", err)
+	}
+}
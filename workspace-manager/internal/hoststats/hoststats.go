@@ -0,0 +1,84 @@
+package hoststats
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+type Usage struct {
+	CPUs   int     `json:"cpus"`
+	Load1  float64 `json:"load_1"`
+	Load5  float64 `json:"load_5"`
+	Load15 float64 `json:"load_15"`
+
+	MemTotalBytes     uint64 `json:"mem_total_bytes"`
+	MemAvailableBytes uint64 `json:"mem_available_bytes"`
+
+	DiskPath       string `json:"disk_path"`
+	DiskTotalBytes uint64 `json:"disk_total_bytes"`
+	DiskFreeBytes  uint64 `json:"disk_free_bytes"`
+}
+
+// Collect reads CPU, memory and load from /proc and disk usage of the
+// filesystem holding diskPath.
+func Collect(diskPath string) (*Usage, error) {
+	u := &Usage{
+		CPUs:     runtime.NumCPU(),
+		DiskPath: diskPath,
+	}
+
+	load, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Sscanf(string(load), "%f %f %f", &u.Load1, &u.Load5, &u.Load15); err != nil {
+		return nil, fmt.Errorf("parse loadavg: %w", err)
+	}
+
+	if err := readMeminfo(u); err != nil {
+		return nil, err
+	}
+
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(diskPath, &fs); err != nil {
+		return nil, err
+	}
+	u.DiskTotalBytes = fs.Blocks * uint64(fs.Bsize)
+	u.DiskFreeBytes = fs.Bavail * uint64(fs.Bsize)
+
+	return u, nil
+}
+
+func readMeminfo(u *Usage) error {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		switch fields[0] {
+		case "MemTotal:":
+			u.MemTotalBytes = kb * 1024
+		case "MemAvailable:":
+			u.MemAvailableBytes = kb * 1024
+		}
+	}
+	return scanner.Err()
+}
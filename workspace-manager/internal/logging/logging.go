@@ -0,0 +1,177 @@
+// Package logging sets up the structured logger. Every record carries the
+// correlation fields stored in its context (request, user, instance and
+// operation IDs, plus the trace), and secrets are redacted before anything
+// is written.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Correlation keys, shared by everything that logs so records can be joined
+// across requests, workers and traces.
+const (
+	RequestIDKey   = "request_id"
+	UserIDKey      = "user_id"
+	InstanceIDKey  = "instance_id"
+	OperationIDKey = "operation_id"
+)
+
+// Config picks the level and output format.
+type Config struct {
+	Level  string // debug | info | warn | error
+	Format string // json | text
+}
+
+// ParseLevel turns a level name into a slog level.
+func ParseLevel(s string) (slog.Level, error) {
+	var l slog.Level
+	err := l.UnmarshalText([]byte(s))
+	return l, err
+}
+
+// New returns a logger writing to w.
+func New(w io.Writer, cfg Config) (*slog.Logger, error) {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redact}
+
+	var h slog.Handler
+	switch cfg.Format {
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	case "text":
+		h = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+	return slog.New(contextHandler{h}), nil
+}
+
+type ctxKey struct{}
+
+// With returns a context whose log records carry attrs. Later values for a
+// key replace earlier ones.
+func With(ctx context.Context, attrs ...slog.Attr) context.Context {
+	prev, _ := ctx.Value(ctxKey{}).([]slog.Attr)
+	merged := make([]slog.Attr, 0, len(prev)+len(attrs))
+	for _, a := range prev {
+		if !hasKey(attrs, a.Key) {
+			merged = append(merged, a)
+		}
+	}
+	return context.WithValue(ctx, ctxKey{}, append(merged, attrs...))
+}
+
+func hasKey(attrs []slog.Attr, key string) bool {
+	for _, a := range attrs {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// WithOperation tags ctx with a fresh operation ID, for background work that
+// has no request ID of its own.
+func WithOperation(ctx context.Context, attrs ...slog.Attr) context.Context {
+	return With(ctx, append([]slog.Attr{slog.String(OperationIDKey, uuid.NewString())}, attrs...)...)
+}
+
+// Detach returns a context for work that outlives ctx, such as a goroutine
+// still running after the response is sent. It keeps ctx's log fields and
+// trace, but not its cancellation or any other values.
+func Detach(ctx context.Context) context.Context {
+	d := context.Background()
+	if attrs, ok := ctx.Value(ctxKey{}).([]slog.Attr); ok {
+		d = context.WithValue(d, ctxKey{}, attrs)
+	}
+	return trace.ContextWithSpanContext(d, trace.SpanContextFromContext(ctx))
+}
+
+// contextHandler adds the context's correlation fields to each record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs, ok := ctx.Value(ctxKey{}).([]slog.Attr); ok {
+		r.AddAttrs(attrs...)
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are substrings of attribute keys whose values are never
+// logged, whatever they hold.
+var sensitiveKeys = []string{
+	"password", "passwd", "secret", "token", "authorization", "cookie",
+	"api_key", "apikey", "private_key", "recovery_code", "totp", "otp_code",
+}
+
+var (
+	// credentials that turn up inside otherwise harmless strings, such as
+	// error messages: bearer tokens, JWTs, our API tokens and URL userinfo
+	bearerRe   = regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/=-]+`)
+	jwtRe      = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	apiTokenRe = regexp.MustCompile(`\bwmp_[A-Za-z0-9_-]{16,}`)
+	userinfoRe = regexp.MustCompile(`(\w+://[^:/@\s]+):[^@\s]+@`)
+)
+
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() == slog.KindGroup {
+		return a
+	}
+
+	// token_id and the like name a secret rather than hold it
+	key := strings.ToLower(a.Key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(key, s) && !strings.HasSuffix(key, "_id") {
+			return slog.String(a.Key, redacted)
+		}
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, RedactString(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, RedactString(err.Error()))
+		}
+	}
+	return a
+}
+
+// RedactString masks credentials embedded in s.
+func RedactString(s string) string {
+	s = bearerRe.ReplaceAllString(s, "$1 "+redacted)
+	s = jwtRe.ReplaceAllString(s, redacted)
+	s = apiTokenRe.ReplaceAllString(s, redacted)
+	s = userinfoRe.ReplaceAllString(s, "$1:"+redacted+"@")
+	return s
+}
@@ -0,0 +1,24 @@
+package mailer
+
+import "sync"
+
+// Background sends mail after the request asking for it has returned, so
+// slow relays do not hold requests up. Sends are counted on a WaitGroup that
+// shutdown waits on, so they are not cut off at exit.
+type Background struct {
+	Mailer
+	wg *sync.WaitGroup
+}
+
+func NewBackground(m Mailer, wg *sync.WaitGroup) *Background {
+	return &Background{Mailer: m, wg: wg}
+}
+
+// Go runs send in its own goroutine.
+func (b *Background) Go(send func()) {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		send()
+	}()
+}
@@ -0,0 +1,53 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+)
+
+// Message is a rendered plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Config selects and configures a Mailer.
+type Config struct {
+	Driver string // smtp | file | log
+
+	From string
+
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+
+	// file driver output directory
+	Dir string
+}
+
+// New builds the Mailer named by cfg.Driver, defaulting to the log mailer.
+func New(cfg Config) (Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		if cfg.SMTPHost == "" || cfg.From == "" {
+			return nil, fmt.Errorf("smtp mailer needs a host and from address")
+		}
+		return NewSMTPMailer(cfg), nil
+	case "file":
+		if cfg.Dir == "" {
+			return nil, fmt.Errorf("file mailer needs a directory")
+		}
+		return NewFileMailer(cfg.Dir, cfg.From), nil
+	case "", "log":
+		return LogMailer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown mailer %q", cfg.Driver)
+	}
+}
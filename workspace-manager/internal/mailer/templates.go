@@ -0,0 +1,31 @@
+package mailer
+
+import (
+	"embed"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+var templates = template.Must(template.ParseFS(templateFS, "templates/*.tmpl"))
+
+// Render builds a message from the named template. Each template file
+// defines "<name>.subject" and "<name>.body".
+func Render(name, to string, data any) (Message, error) {
+	var subject, body strings.Builder
+
+	if err := templates.ExecuteTemplate(&subject, name+".subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := templates.ExecuteTemplate(&body, name+".body", data); err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		Body:    strings.TrimSpace(body.String()) + "\n",
+	}, nil
+}
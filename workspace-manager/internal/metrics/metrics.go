@@ -0,0 +1,132 @@
+// Package metrics holds the Prometheus metrics the manager exports on
+// /metrics.
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	db "example.com/m/v2/db/sqlc"
+)
+
+const namespace = "ambilio"
+
+var (
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "API request latency by route template.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// Starting a workspace pulls images and waits for containers or ECS
+	// tasks, so the buckets reach well past the HTTP ones.
+	WorkspaceOperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "workspace_operation_duration_seconds",
+		Help:      "Time taken to start or stop a workspace.",
+		Buckets:   []float64{0.5, 1, 2, 5, 10, 20, 30, 60, 120, 300},
+	}, []string{"runtime", "operation", "type"})
+
+	WorkspaceOperationFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "workspace_operation_failures_total",
+		Help:      "Workspace starts and stops that failed.",
+	}, []string{"runtime", "operation", "type"})
+
+	AutoStopActions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "autostop_actions_total",
+		Help:      "Expired workspaces the auto-stop worker acted on, by result.",
+	}, []string{"result"})
+
+	WebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_delivery_attempts_total",
+		Help:      "Webhook delivery attempts, by result: delivered, retried or failed.",
+	}, []string{"result"})
+
+	ProxyConnections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "proxy_connections_total",
+		Help:      "Requests proxied to workspaces.",
+	}, []string{"type", "protocol"})
+
+	ProxyActiveConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "proxy_active_connections",
+		Help:      "Requests and WebSocket sessions currently proxied to workspaces.",
+	}, []string{"type", "protocol"})
+
+	// in is from the client to the workspace, out the other way
+	ProxyBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "proxy_bytes_total",
+		Help:      "Bytes proxied to and from workspaces.",
+	}, []string{"type", "direction"})
+)
+
+// ObserveOperation records a workspace start or stop that began at start.
+// err is the operation's result.
+func ObserveOperation(runtime, operation, workspaceType string, start time.Time, err error) {
+	WorkspaceOperationDuration.WithLabelValues(runtime, operation, workspaceType).Observe(time.Since(start).Seconds())
+	if err != nil {
+		WorkspaceOperationFailures.WithLabelValues(runtime, operation, workspaceType).Inc()
+	}
+}
+
+// TrackProxy counts a proxied request or WebSocket session and returns the
+// function to call when it ends.
+func TrackProxy(workspaceType, protocol string) func() {
+	ProxyConnections.WithLabelValues(workspaceType, protocol).Inc()
+	active := ProxyActiveConnections.WithLabelValues(workspaceType, protocol)
+	active.Inc()
+	return active.Dec
+}
+
+var instancesDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "", "instances"),
+	"Instances by type and status.",
+	[]string{"type", "status"}, nil,
+)
+
+// instanceCollector reads instance counts from the database at scrape time,
+// so they are right whichever replica is scraped.
+type instanceCollector struct {
+	q *db.Queries
+}
+
+func (c instanceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- instancesDesc
+}
+
+func (c instanceCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	counts, err := c.q.CountInstancesByStatus(ctx)
+	if err != nil {
+		slog.Error("counting instances for metrics failed", "error", err)
+		return
+	}
+	for _, row := range counts {
+		ch <- prometheus.MustNewConstMetric(instancesDesc, prometheus.GaugeValue,
+			float64(row.Count), row.Type, row.Status)
+	}
+}
+
+// RegisterInstanceCounts exports instance counts from q.
+func RegisterInstanceCounts(q *db.Queries) {
+	prometheus.MustRegister(instanceCollector{q: q})
+}
+
+// Handler serves every registered metric in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
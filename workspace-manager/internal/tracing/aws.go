@@ -0,0 +1,33 @@
+package tracing
+
+import (
+	"context"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// AWS gives every call an AWS SDK client makes its own span, e.g.
+// "ECS.DescribeTasks". Add it to the config's APIOptions:
+//
+//	cfg.APIOptions = append(cfg.APIOptions, tracing.AWS)
+func AWS(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("Tracing",
+		func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			service := awsmiddleware.GetServiceID(ctx)
+			operation := awsmiddleware.GetOperationName(ctx)
+
+			ctx, span := Start(ctx, "github.com/aws/aws-sdk-go-v2", service+"."+operation,
+				attribute.String("rpc.system", "aws-api"),
+				attribute.String("rpc.service", service),
+				attribute.String("rpc.method", operation),
+			)
+			out, md, err := next.HandleInitialize(ctx, in)
+			if id, ok := awsmiddleware.GetRequestIDMetadata(md); ok {
+				span.SetAttributes(attribute.String("aws.request_id", id))
+			}
+			End(span, err)
+			return out, md, err
+		}), middleware.After)
+}
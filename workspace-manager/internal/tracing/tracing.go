@@ -0,0 +1,140 @@
+// Package tracing sets up OpenTelemetry and holds the helpers the rest of
+// the manager uses to create spans and find the current trace ID.
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand/v2"
+	"regexp"
+
+	"github.com/XSAM/otelsql"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const ServiceName = "workspace-manager"
+
+// Config says where spans go. Spans are still created, and trace IDs still
+// handed out, when Endpoint is empty; they are just not exported.
+type Config struct {
+	Endpoint    string // OTLP/HTTP collector URL, e.g. http://collector:4318
+	SampleRatio float64
+	Environment string
+}
+
+// Init installs the global tracer provider and propagator. The returned
+// function flushes buffered spans and must be called before exiting.
+func Init(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(ServiceName),
+		semconv.DeploymentEnvironmentName(cfg.Environment),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(
+			sdktrace.TraceIDRatioBased(cfg.SampleRatio),
+			// a caller's traceparent is joined but does not decide sampling
+			sdktrace.WithRemoteParentSampled(edgeSampler{cfg.SampleRatio}),
+			sdktrace.WithRemoteParentNotSampled(edgeSampler{cfg.SampleRatio}),
+		)),
+	}
+	if cfg.Endpoint != "" {
+		// headers, e.g. for collector auth, come from OTEL_EXPORTER_OTLP_HEADERS
+		exp, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, sdktrace.WithBatcher(exp))
+	}
+
+	tp := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	return tp.Shutdown, nil
+}
+
+// edgeSampler samples spans continuing a remote trace at ratio, ignoring
+// the caller's sampled flag. The draw is random rather than keyed on the
+// trace ID, since callers choose their trace IDs too.
+type edgeSampler struct {
+	ratio float64
+}
+
+func (s edgeSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	decision := sdktrace.Drop
+	if rand.Float64() < s.ratio {
+		decision = sdktrace.RecordAndSample
+	}
+	return sdktrace.SamplingResult{
+		Decision:   decision,
+		Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+	}
+}
+
+func (s edgeSampler) Description() string {
+	return fmt.Sprintf("EdgeSampler{%g}", s.ratio)
+}
+
+// sqlcName matches the header sqlc puts on every generated query.
+var sqlcName = regexp.MustCompile(`^-- name: (\w+)`)
+
+// OpenDB opens a database whose queries are traced. Spans are named after
+// the sqlc query, e.g. "db GetUserByID", so they can be told apart at a
+// glance.
+func OpenDB(driverName, dsn string) (*sql.DB, error) {
+	return otelsql.Open(driverName, dsn,
+		otelsql.WithAttributes(semconv.DBSystemNamePostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			OmitConnResetSession: true,
+			OmitConnPrepare:      true,
+			OmitRows:             true,
+		}),
+		otelsql.WithSpanNameFormatter(func(_ context.Context, method otelsql.Method, query string) string {
+			if m := sqlcName.FindStringSubmatch(query); m != nil {
+				return "db " + m[1]
+			}
+			return string(method)
+		}),
+	)
+}
+
+// Start begins a span from the named package's tracer.
+func Start(ctx context.Context, tracer, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracer).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End finishes span, marking it failed if err is set.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TraceID returns the ID of the trace ctx belongs to, or "" outside one.
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
@@ -0,0 +1,122 @@
+// Package webhook queues instance lifecycle events for the webhooks that
+// subscribe to them, and signs what is sent.
+//
+// Events go to a durable outbox, webhook_deliveries, in the same database as
+// the instances; the delivery worker sends them from there and retries
+// failures, so an event is not lost when a receiver is down or the manager
+// restarts.
+//
+// Each request is a POST of the JSON payload with these headers:
+//
+//	X-Webhook-Event:     the event name, e.g. instance.started
+//	X-Webhook-Delivery:  the delivery ID, the same on every retry
+//	X-Webhook-Timestamp: Unix seconds when the attempt was made
+//	X-Webhook-Signature: sha256=<hex HMAC-SHA256 of "<timestamp>.<body>">
+//
+// Receivers should recompute the signature with their webhook's secret,
+// compare it in constant time, and reject old timestamps to stop replays.
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	db "example.com/m/v2/db/sqlc"
+)
+
+// Events a webhook can subscribe to.
+const (
+	InstanceStarted = "instance.started"
+	InstanceStopped = "instance.stopped"
+	InstanceExpired = "instance.expired" // stopped at the end of its TTL
+	InstanceFailed  = "instance.failed"  // failed to start, or its container died
+)
+
+// Events lists every event, for validating subscriptions.
+var Events = []string{InstanceStarted, InstanceStopped, InstanceExpired, InstanceFailed}
+
+// Valid reports whether event is one webhooks can subscribe to.
+func Valid(event string) bool {
+	return slices.Contains(Events, event)
+}
+
+// Payload is the body of every delivery.
+type Payload struct {
+	// ID identifies the event; every webhook notified of it gets the same ID
+	ID         uuid.UUID      `json:"id"`
+	Event      string         `json:"event"`
+	OccurredAt time.Time      `json:"occurred_at"`
+	Instance   Instance       `json:"instance"`
+	Data       map[string]any `json:"data"`
+}
+
+// Instance is what a payload tells about the instance; never its
+// credentials.
+type Instance struct {
+	ID        uuid.UUID  `json:"id"`
+	Type      string     `json:"type"`
+	Status    string     `json:"status"`
+	UserID    uuid.UUID  `json:"user_id"`
+	OrgID     *uuid.UUID `json:"org_id"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Notify queues event about inst for the organization's webhooks if it is an
+// org instance, or else its owner's. data adds event-specific detail. Failures
+// are logged rather than returned so a webhook never breaks the action it
+// reports.
+func Notify(ctx context.Context, q *db.Queries, event string, inst db.Instances, data map[string]any) {
+	if data == nil {
+		data = map[string]any{}
+	}
+
+	p := Payload{
+		ID:         uuid.New(),
+		Event:      event,
+		OccurredAt: time.Now().UTC(),
+		Instance: Instance{
+			ID:        inst.ID,
+			Type:      inst.Type,
+			Status:    inst.Status,
+			UserID:    inst.UserID,
+			CreatedAt: inst.CreatedAt,
+		},
+		Data: data,
+	}
+	if inst.OrgID.Valid {
+		p.Instance.OrgID = &inst.OrgID.UUID
+	}
+
+	body, err := json.Marshal(p)
+	if err != nil {
+		slog.ErrorContext(ctx, "encoding webhook payload failed", "event", event, "error", err)
+		return
+	}
+
+	if _, err := q.EnqueueWebhookDeliveries(ctx, db.EnqueueWebhookDeliveriesParams{
+		Event:   event,
+		Payload: body,
+		UserID:  inst.UserID,
+		OrgID:   inst.OrgID,
+	}); err != nil {
+		slog.ErrorContext(ctx, "queueing webhook deliveries failed", "event", event, "error", err)
+	}
+}
+
+// Sign returns the X-Webhook-Signature value for body sent at timestamp.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,56 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"event":"instance.started"}`)
+	at := time.Unix(1700000000, 0)
+
+	// expected values are HMAC-SHA256 over "<unix seconds>.<body>", as a
+	// receiver following the package docs would compute them
+	tests := []struct {
+		name   string
+		secret string
+		at     time.Time
+		body   []byte
+		want   string
+	}{
+		{"payload", "whsec_test", at, body, "sha256=84962d3ee5b583842f9cf06841fe06abf740a51ecb4ff558a40dfe2e78923e36"},
+		{"empty body", "whsec_test", at, nil, "sha256=5967f3c560522fa40cf2876ebc3c3a08551dd6959aaade3b413460591895bdcc"},
+		{"other secret", "other", at, body, "sha256=48fef80605ca529194919622f3e92a52133c3c989542cf34ac24ee3e8e5cfc84"},
+		{"later timestamp", "whsec_test", at.Add(time.Second), body, "sha256=b729e17309c01c6f285392532de94bc2818c8afe885112fa6e8f881ef9da6a88"},
+		// only whole seconds are signed, matching X-Webhook-Timestamp
+		{"sub-second", "whsec_test", at.Add(500 * time.Millisecond), body, "sha256=84962d3ee5b583842f9cf06841fe06abf740a51ecb4ff558a40dfe2e78923e36"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sign(tt.secret, tt.at, tt.body); got != tt.want {
+				t.Errorf("Sign = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		event string
+		want  bool
+	}{
+		{InstanceStarted, true},
+		{InstanceStopped, true},
+		{InstanceExpired, true},
+		{InstanceFailed, true},
+		{"instance.deleted", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := Valid(tt.event); got != tt.want {
+			t.Errorf("Valid(%q) = %v, want %v", tt.event, got, tt.want)
+		}
+	}
+}
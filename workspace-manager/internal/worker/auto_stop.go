@@ -2,31 +2,55 @@ package worker
 
 import (
 	"context"
-	"log"
+	"encoding/json"
+	"log/slog"
+	"sync"
 	"time"
 
 	db "example.com/m/v2/db/sqlc"
-	ecsmanager "example.com/m/v2/ecs"
+	"example.com/m/v2/internal/docker"
+	"example.com/m/v2/internal/logging"
+	"example.com/m/v2/internal/metrics"
+	"example.com/m/v2/internal/webhook"
+
+	"github.com/google/uuid"
 )
 
+// auditAutoStopped is the audit action for an instance stopped at the end of
+// its TTL. The actor is empty: nobody asked for it.
+const auditAutoStopped = "instance.auto_stopped"
+
 type AutoStopWorker struct {
-	q   *db.Queries
-	ecs *ecsmanager.ECSManager
+	q         *db.Queries
+	docker    *docker.DockerManager
+	heartbeat *Heartbeat
+}
+
+func NewAutoStopWorker(q *db.Queries, d *docker.DockerManager) *AutoStopWorker {
+	return &AutoStopWorker{
+		q:         q,
+		docker:    d,
+		heartbeat: newHeartbeat("auto_stop", 15*time.Minute),
+	}
 }
 
-func NewAutoStopWorker(q *db.Queries, ecs *ecsmanager.ECSManager) *AutoStopWorker {
-	return &AutoStopWorker{q: q, ecs: ecs}
+func (w *AutoStopWorker) Heartbeat() *Heartbeat {
+	return w.heartbeat
 }
 
-func (w *AutoStopWorker) Start(ctx context.Context) {
+func (w *AutoStopWorker) Start(ctx context.Context, wg *sync.WaitGroup) {
 	ticker := time.NewTicker(5 * time.Minute) 
+	wg.Add(1)
 	go func() {
+		defer wg.Done()
 		for {
 			select {
 			case <-ticker.C:
+				w.heartbeat.beat()
 				w.runOnce(ctx)
 			case <-ctx.Done():
 				ticker.Stop()
+				w.heartbeat.stop()
 				return
 			}
 		}
@@ -34,25 +58,48 @@ func (w *AutoStopWorker) Start(ctx context.Context) {
 }
 
 func (w *AutoStopWorker) runOnce(ctx context.Context) {
+	ctx = logging.WithOperation(ctx, slog.String("worker", "auto_stop"))
+
 	instances, err := w.q.ListExpiredInstances(ctx)
 	if err != nil {
-		log.Println("auto-stop query error:", err)
+		slog.ErrorContext(ctx, "listing expired instances failed", "error", err)
 		return
 	}
 
 	for _, inst := range instances {
-		if !inst.ContainerID.Valid {
+		// aws sandboxes cannot be stopped, as in StopInstance
+		if !inst.ContainerID.Valid || inst.Type == "aws" {
 			continue
 		}
 
-		log.Printf("🛑 Auto-stopping instance %s\n", inst.ID)
+		ctx := logging.With(ctx, slog.String(logging.InstanceIDKey, inst.ID.String()))
+		slog.InfoContext(ctx, "auto-stopping expired instance")
 
-		err := w.ecs.StopTask(ctx, inst.ContainerID.String)
-		if err != nil {
-			log.Printf("ECS stop failed for %s: %v\n", inst.ID, err)
+		// left running, it is tried again on the next pass
+		if err := w.docker.Stop(ctx, inst.ID.String(), inst.Type); err != nil {
+			slog.ErrorContext(ctx, "stopping expired instance failed", "error", err)
+			metrics.AutoStopActions.WithLabelValues("failed").Inc()
 			continue
 		}
 
-		_ = w.q.StopExpiredInstance(ctx, inst.ID)
+		if err := w.q.StopExpiredInstance(ctx, inst.ID); err != nil {
+			slog.ErrorContext(ctx, "marking expired instance stopped failed", "error", err)
+			metrics.AutoStopActions.WithLabelValues("failed").Inc()
+			continue
+		}
+		metrics.AutoStopActions.WithLabelValues("stopped").Inc()
+		inst.Status = "stopped"
+		webhook.Notify(ctx, w.q, webhook.InstanceExpired, inst, map[string]any{"ttl_hours": inst.TtlHours})
+
+		meta, _ := json.Marshal(map[string]any{"ttl_hours": inst.TtlHours})
+		if err := w.q.CreateAuditEvent(ctx, db.CreateAuditEventParams{
+			SubjectUserID: uuid.NullUUID{UUID: inst.UserID, Valid: true},
+			InstanceID:    uuid.NullUUID{UUID: inst.ID, Valid: true},
+			Action:        auditAutoStopped,
+			Target:        inst.ID.String(),
+			Metadata:      meta,
+		}); err != nil {
+			slog.ErrorContext(ctx, "recording audit event failed", "action", auditAutoStopped, "error", err)
+		}
 	}
 }
@@ -0,0 +1,74 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	db "example.com/m/v2/db/sqlc"
+	"example.com/m/v2/internal/events"
+	"example.com/m/v2/internal/logging"
+)
+
+// ExpiryWarningWorker warns, through the instance event stream, when a
+// running instance's TTL is about to run out. ClaimExpiryWarnings picks
+// the instances within 15 minutes of it and records each warning, so every
+// instance is warned about once, whichever replica gets there first.
+type ExpiryWarningWorker struct {
+	q         *db.Queries
+	heartbeat *Heartbeat
+}
+
+func NewExpiryWarningWorker(q *db.Queries) *ExpiryWarningWorker {
+	return &ExpiryWarningWorker{
+		q:         q,
+		heartbeat: newHeartbeat("expiry_warnings", 5*time.Minute),
+	}
+}
+
+func (w *ExpiryWarningWorker) Heartbeat() *Heartbeat {
+	return w.heartbeat
+}
+
+func (w *ExpiryWarningWorker) Start(ctx context.Context, wg *sync.WaitGroup) {
+	ticker := time.NewTicker(time.Minute)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-ticker.C:
+				w.heartbeat.beat()
+				w.runOnce(ctx)
+			case <-ctx.Done():
+				ticker.Stop()
+				w.heartbeat.stop()
+				return
+			}
+		}
+	}()
+}
+
+func (w *ExpiryWarningWorker) runOnce(ctx context.Context) {
+	ctx = logging.WithOperation(ctx, slog.String("worker", "expiry_warnings"))
+
+	expiring, err := w.q.ClaimExpiryWarnings(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "claiming expiry warnings failed", "error", err)
+		return
+	}
+
+	for _, inst := range expiring {
+		ev := events.Event{
+			Type:       events.TypeExpiryWarning,
+			InstanceID: inst.ID,
+			UserID:     inst.UserID,
+			ExpiresAt:  &inst.ExpiresAt,
+		}
+		if inst.OrgID.Valid {
+			ev.OrgID = &inst.OrgID.UUID
+		}
+		events.Publish(ctx, w.q, ev)
+	}
+}
@@ -0,0 +1,320 @@
+package worker
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	db "example.com/m/v2/db/sqlc"
+	"example.com/m/v2/internal/logging"
+)
+
+// exportRetention is how long a finished archive can be downloaded.
+const exportRetention = 7 * 24 * time.Hour
+
+// ExportPath is where the archive for a data export is written.
+func ExportPath(dir string, userID, exportID uuid.UUID) string {
+	return filepath.Join(dir, userID.String(), exportID.String()+".zip")
+}
+
+// ExportWorker builds requested data exports one at a time and deletes
+// archives once they expire.
+type ExportWorker struct {
+	q         *db.Queries
+	dir       string
+	heartbeat *Heartbeat
+}
+
+func NewExportWorker(q *db.Queries, dir string) *ExportWorker {
+	return &ExportWorker{
+		q:   q,
+		dir: dir,
+		// a large export may take a while; ClaimDataExport gives up on it
+		// after an hour too
+		heartbeat: newHeartbeat("export", time.Hour),
+	}
+}
+
+func (w *ExportWorker) Heartbeat() *Heartbeat {
+	return w.heartbeat
+}
+
+func (w *ExportWorker) Start(ctx context.Context, wg *sync.WaitGroup) {
+	ticker := time.NewTicker(15 * time.Second)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-ticker.C:
+				w.heartbeat.beat()
+				w.runOnce(ctx)
+			case <-ctx.Done():
+				ticker.Stop()
+				w.heartbeat.stop()
+				return
+			}
+		}
+	}()
+}
+
+func (w *ExportWorker) runOnce(ctx context.Context) {
+	ctx = logging.WithOperation(ctx, slog.String("worker", "export"))
+	w.purgeExpired(ctx)
+
+	for ctx.Err() == nil {
+		w.heartbeat.beat()
+
+		exp, err := w.q.ClaimDataExport(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "claiming data export failed", "error", err)
+			return
+		}
+		ctx := logging.With(ctx,
+			slog.String("export_id", exp.ID.String()),
+			slog.String(logging.UserIDKey, exp.UserID.String()),
+		)
+
+		path := ExportPath(w.dir, exp.UserID, exp.ID)
+
+		size, err := w.build(ctx, exp, path)
+		if err != nil && ctx.Err() != nil {
+			// shutting down: hand it to the next worker rather than failing it
+			if err := w.q.ReleaseDataExport(context.WithoutCancel(ctx), exp.ID); err != nil {
+				slog.ErrorContext(ctx, "releasing data export failed", "error", err)
+			}
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "building data export failed", "error", err)
+			if err := w.q.FailDataExport(ctx, db.FailDataExportParams{
+				ID:    exp.ID,
+				Error: "the archive could not be built",
+			}); err != nil {
+				slog.ErrorContext(ctx, "recording data export failure failed", "error", err)
+			}
+			continue
+		}
+
+		if err := w.q.CompleteDataExport(ctx, db.CompleteDataExportParams{
+			ID:        exp.ID,
+			SizeBytes: sql.NullInt64{Int64: size, Valid: true},
+			ExpiresAt: sql.NullTime{Time: time.Now().Add(exportRetention), Valid: true},
+		}); err != nil {
+			slog.ErrorContext(ctx, "completing data export failed", "error", err)
+			continue
+		}
+		slog.InfoContext(ctx, "data export ready", "size_bytes", size)
+	}
+}
+
+func (w *ExportWorker) purgeExpired(ctx context.Context) {
+	expired, err := w.q.ListExpiredDataExports(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "listing expired data exports failed", "error", err)
+		return
+	}
+
+	for _, exp := range expired {
+		if err := os.Remove(ExportPath(w.dir, exp.UserID, exp.ID)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			slog.ErrorContext(ctx, "removing expired data export failed", "export_id", exp.ID, "error", err)
+			continue
+		}
+		if err := w.q.DeleteDataExport(ctx, exp.ID); err != nil {
+			slog.ErrorContext(ctx, "deleting expired data export failed", "export_id", exp.ID, "error", err)
+		}
+	}
+}
+
+// build writes the archive to a temporary file and moves it into place, so
+// a half-written archive is never served.
+func (w *ExportWorker) build(ctx context.Context, exp db.DataExports, path string) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return 0, err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), ".export-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	if err := w.writeArchive(ctx, zw, exp); err != nil {
+		return 0, err
+	}
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return 0, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (w *ExportWorker) writeArchive(ctx context.Context, zw *zip.Writer, exp db.DataExports) error {
+	u, err := w.q.GetUserByID(ctx, exp.UserID)
+	if err != nil {
+		return err
+	}
+
+	profile, err := w.q.GetUserProfile(ctx, exp.UserID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	identities, err := w.q.ListUserIdentities(ctx, exp.UserID)
+	if err != nil {
+		return err
+	}
+
+	orgs, err := w.q.ListUserOrganizations(ctx, exp.UserID)
+	if err != nil {
+		return err
+	}
+
+	tokens, err := w.q.ListUserAPITokens(ctx, exp.UserID)
+	if err != nil {
+		return err
+	}
+	for i := range tokens {
+		tokens[i].TokenHash = ""
+	}
+
+	if err := writeJSON(zw, "account.json", map[string]any{
+		"id":                exp.UserID,
+		"email":             u.Email,
+		"email_verified_at": u.EmailVerifiedAt,
+		"role":              u.Role,
+		"created_at":        u.CreatedAt,
+		"profile":           profile,
+		"identities":        identities,
+		"organizations":     orgs,
+		"api_tokens":        tokens,
+	}); err != nil {
+		return err
+	}
+
+	owned, err := w.q.ListUserInstances(ctx, exp.UserID)
+	if err != nil {
+		return err
+	}
+	shared, err := w.q.ListMemberInstances(ctx, exp.UserID)
+	if err != nil {
+		return err
+	}
+	for i := range owned {
+		owned[i].AwsPassword = sql.NullString{}
+	}
+	for i := range shared {
+		shared[i].AwsPassword = sql.NullString{}
+	}
+
+	if err := writeJSON(zw, "instances.json", map[string]any{
+		"owned":     owned,
+		"member_of": shared,
+	}); err != nil {
+		return err
+	}
+
+	events, err := w.q.ListUserAuditEvents(ctx, uuid.NullUUID{UUID: exp.UserID, Valid: true})
+	if err != nil {
+		return err
+	}
+
+	ew, err := zw.Create("audit_events.jsonl")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(ew)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+
+	if !exp.IncludeData {
+		return nil
+	}
+
+	for _, inst := range owned {
+		if err := addDir(ctx, zw, inst.EfsPath, "data/"+inst.ID.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeJSON(zw *zip.Writer, name string, v any) error {
+	fw, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(fw)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// addDir copies the regular files under root into the archive below prefix.
+// Symlinks are skipped so a workspace cannot pull in files from elsewhere on
+// the host.
+func addDir(ctx context.Context, zw *zip.Writer, root, prefix string) error {
+	// instances that never started may have no directory
+	if _, err := os.Stat(root); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		dst, err := zw.Create(prefix + "/" + filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(dst, src)
+		return err
+	})
+}
@@ -0,0 +1,47 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Heartbeat records when a worker's loop last came round, so a worker that
+// died or got stuck shows up in the workers' status.
+type Heartbeat struct {
+	Name string
+
+	// how long a single run may reasonably take before the worker counts
+	// as stuck
+	maxAge time.Duration
+
+	last    atomic.Int64 // unix nanoseconds
+	stopped atomic.Bool
+}
+
+func newHeartbeat(name string, maxAge time.Duration) *Heartbeat {
+	h := &Heartbeat{Name: name, maxAge: maxAge}
+	h.beat()
+	return h
+}
+
+func (h *Heartbeat) beat() {
+	h.last.Store(time.Now().UnixNano())
+}
+
+func (h *Heartbeat) stop() {
+	h.stopped.Store(true)
+}
+
+// Check returns an error if the worker has stopped or has not come round
+// for longer than expected.
+func (h *Heartbeat) Check() error {
+	if h.stopped.Load() {
+		return errors.New("stopped")
+	}
+	if age := time.Since(time.Unix(0, h.last.Load())); age > h.maxAge {
+		return fmt.Errorf("last ran %s ago", age.Round(time.Second))
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync"
+	"time"
+
+	"example.com/m/v2/util"
+)
+
+// rotationLockID is the advisory lock held while rotating a shared key
+// directory, so replicas whose timers fire together rotate it once.
+const rotationLockID = 7_341_902_117
+
+// KeyRotationWorker rotates the JWT signing key once it is older than every.
+// It also reloads the key directory so keys rotated by other replicas are
+// served from the JWKS endpoint promptly.
+type KeyRotationWorker struct {
+	conn      *sql.DB
+	keys      *util.KeyRing
+	every     time.Duration
+	heartbeat *Heartbeat
+}
+
+func NewKeyRotationWorker(conn *sql.DB, keys *util.KeyRing, every time.Duration) *KeyRotationWorker {
+	return &KeyRotationWorker{
+		conn:      conn,
+		keys:      keys,
+		every:     every,
+		heartbeat: newHeartbeat("key_rotation", 5*time.Minute),
+	}
+}
+
+func (w *KeyRotationWorker) Heartbeat() *Heartbeat {
+	return w.heartbeat
+}
+
+func (w *KeyRotationWorker) Start(ctx context.Context, wg *sync.WaitGroup) {
+	ticker := time.NewTicker(time.Minute)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-ticker.C:
+				w.heartbeat.beat()
+				w.runOnce(ctx)
+			case <-ctx.Done():
+				ticker.Stop()
+				w.heartbeat.stop()
+				return
+			}
+		}
+	}()
+}
+
+func (w *KeyRotationWorker) runOnce(ctx context.Context) {
+	if err := w.keys.Reload(); err != nil {
+		slog.Error("reloading jwt signing keys failed", "error", err)
+		return
+	}
+
+	if w.keys.SignerAge() < w.every {
+		return
+	}
+
+	// keys held in memory are this replica's own
+	if !w.keys.Persistent() {
+		w.rotate()
+		return
+	}
+
+	conn, err := w.conn.Conn(ctx)
+	if err != nil {
+		slog.Error("locking jwt key rotation failed", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", rotationLockID).Scan(&locked); err != nil {
+		slog.Error("locking jwt key rotation failed", "error", err)
+		return
+	}
+	if !locked {
+		// another replica is rotating; its key turns up in the next reload
+		return
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", rotationLockID)
+
+	// the replica that held the lock last may have rotated since the reload
+	// above
+	if err := w.keys.Reload(); err != nil {
+		slog.Error("reloading jwt signing keys failed", "error", err)
+		return
+	}
+	if w.keys.SignerAge() < w.every {
+		return
+	}
+
+	w.rotate()
+}
+
+func (w *KeyRotationWorker) rotate() {
+	if err := w.keys.Rotate(); err != nil {
+		slog.Error("rotating jwt signing key failed", "error", err)
+		return
+	}
+	slog.Info("rotated jwt signing key")
+}
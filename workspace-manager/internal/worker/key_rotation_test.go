@@ -0,0 +1,86 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"example.com/m/v2/util"
+)
+
+func TestKeyRotationInMemory(t *testing.T) {
+	kr, err := util.LoadKeyRing("", util.AlgEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := kr.JWKS()[0].Kid
+
+	// in-memory keys need no lock, so no database either
+	w := NewKeyRotationWorker(nil, kr, time.Nanosecond)
+	w.runOnce(context.Background())
+
+	if after := kr.JWKS()[0].Kid; after == before {
+		t.Error("signing key not rotated")
+	}
+}
+
+// TestKeyRotationOncePerPeriod runs replicas sharing a key directory at the
+// same moment, checking that only one of them rotates. It needs
+// TEST_DATABASE_URL for the lock.
+func TestKeyRotationOncePerPeriod(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	conn, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	dir := t.TempDir()
+	if _, err := util.LoadKeyRing(dir, util.AlgEdDSA); err != nil {
+		t.Fatal(err)
+	}
+	first, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil || len(first) != 1 {
+		t.Fatalf("keys = %v, %v; want one", first, err)
+	}
+	// the first key is due for rotation, one made now is not
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(first[0], old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	const replicas = 4
+	var wg sync.WaitGroup
+	for range replicas {
+		kr, err := util.LoadKeyRing(dir, util.AlgEdDSA)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := NewKeyRotationWorker(conn, kr, 30*time.Minute)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.runOnce(context.Background())
+		}()
+	}
+	wg.Wait()
+
+	keys, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Errorf("%d keys after rotating, want the first and one new one", len(keys))
+	}
+}
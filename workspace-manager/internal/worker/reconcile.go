@@ -0,0 +1,121 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	db "example.com/m/v2/db/sqlc"
+	"example.com/m/v2/internal/docker"
+	"example.com/m/v2/internal/logging"
+	"example.com/m/v2/internal/webhook"
+)
+
+// startGrace is how long a new container is left alone while no running
+// instance claims it. An instance is only marked running once Run returns,
+// which can wait HealthTimeout after creating the containers, so until then
+// they are most likely a workspace still starting.
+const startGrace = 2 * docker.HealthTimeout
+
+// Reconciler brings the instances table and the host's workspace containers
+// back in line after crashes or manual docker changes.
+type Reconciler struct {
+	q      *db.Queries
+	docker *docker.DockerManager
+}
+
+type ReconcileReport struct {
+	MarkedStopped     []uuid.UUID `json:"marked_stopped"`
+	RemovedContainers []string    `json:"removed_containers"`
+}
+
+func NewReconciler(q *db.Queries, d *docker.DockerManager) *Reconciler {
+	return &Reconciler{q: q, docker: d}
+}
+
+// RunOnce marks running instances without a container as stopped and removes
+// containers that belong to no running instance, other than those created
+// within startGrace.
+func (r *Reconciler) RunOnce(ctx context.Context) (*ReconcileReport, error) {
+	running, err := r.q.ListRunningInstances(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	containers, err := r.docker.ListWorkspaceContainers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	missing, orphans := mismatches(running, containers, time.Now())
+
+	report := &ReconcileReport{
+		MarkedStopped:     []uuid.UUID{},
+		RemovedContainers: []string{},
+	}
+
+	for _, inst := range missing {
+		slog.InfoContext(ctx, "reconcile: instance has no container, marking stopped", logging.InstanceIDKey, inst.ID)
+		stopped, err := r.q.UpdateInstanceStatus(ctx, db.UpdateInstanceStatusParams{
+			ID:     inst.ID,
+			Status: "stopped",
+		})
+		if err != nil {
+			return report, err
+		}
+		webhook.Notify(ctx, r.q, webhook.InstanceFailed, stopped, map[string]any{"reason": "container_missing"})
+		report.MarkedStopped = append(report.MarkedStopped, inst.ID)
+	}
+
+	for id, names := range orphans {
+		slog.InfoContext(ctx, "reconcile: removing orphaned containers", logging.InstanceIDKey, id, "containers", names)
+		if err := r.docker.Stop(ctx, id.String(), ""); err != nil {
+			slog.WarnContext(ctx, "reconcile: removing orphaned containers failed", logging.InstanceIDKey, id, "error", err)
+			continue
+		}
+		report.RemovedContainers = append(report.RemovedContainers, names...)
+	}
+
+	return report, nil
+}
+
+// mismatches returns the running instances that have no container, and the
+// containers, by instance, that belong to no running instance. An instance
+// with any container created within startGrace counts as starting, and its
+// containers are left out.
+func mismatches(running []db.Instances, containers []docker.Container, now time.Time) ([]db.Instances, map[uuid.UUID][]string) {
+	// container names end in the instance ID, e.g. ws_mysql_adminer_<id>
+	byInstance := map[uuid.UUID][]string{}
+	starting := map[uuid.UUID]bool{}
+	for _, ct := range containers {
+		name := ct.Name
+		if !strings.HasPrefix(name, "ws_") || len(name) < 36 {
+			continue
+		}
+		id, err := uuid.Parse(name[len(name)-36:])
+		if err != nil {
+			continue
+		}
+		byInstance[id] = append(byInstance[id], name)
+		if now.Sub(ct.CreatedAt) < startGrace {
+			starting[id] = true
+		}
+	}
+
+	var missing []db.Instances
+	for _, inst := range running {
+		if _, ok := byInstance[inst.ID]; ok {
+			delete(byInstance, inst.ID)
+			continue
+		}
+		missing = append(missing, inst)
+	}
+
+	for id := range starting {
+		delete(byInstance, id)
+	}
+	return missing, byInstance
+}
@@ -0,0 +1,75 @@
+package worker
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	db "example.com/m/v2/db/sqlc"
+	"example.com/m/v2/internal/docker"
+)
+
+func TestMismatches(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-time.Hour)
+	young := now.Add(-10 * time.Second)
+
+	running := uuid.New()
+	vanished := uuid.New()
+	orphaned := uuid.New()
+	starting := uuid.New()
+	startingMySQL := uuid.New()
+
+	instances := []db.Instances{{ID: running}, {ID: vanished}}
+	containers := []docker.Container{
+		{Name: "ws_" + running.String(), CreatedAt: old},
+		{Name: "ws_" + orphaned.String(), CreatedAt: old},
+		// still inside Run, so not marked running yet
+		{Name: "ws_" + starting.String(), CreatedAt: young},
+		{Name: "ws_mysql_" + startingMySQL.String(), CreatedAt: young.Add(-5 * time.Second)},
+		{Name: "ws_mysql_adminer_" + startingMySQL.String(), CreatedAt: young},
+		{Name: "ws_not-an-instance", CreatedAt: old},
+		{Name: "postgres", CreatedAt: old},
+	}
+
+	missing, orphans := mismatches(instances, containers, now)
+
+	if len(missing) != 1 || missing[0].ID != vanished {
+		t.Errorf("missing = %v, want just %s", missing, vanished)
+	}
+
+	if len(orphans) != 1 {
+		t.Fatalf("orphans = %v, want just %s", orphans, orphaned)
+	}
+	if names := orphans[orphaned]; !slices.Equal(names, []string{"ws_" + orphaned.String()}) {
+		t.Errorf("orphans[%s] = %v", orphaned, names)
+	}
+}
+
+func TestMismatchesStartGrace(t *testing.T) {
+	now := time.Now()
+	id := uuid.New()
+
+	tests := []struct {
+		name   string
+		age    time.Duration
+		orphan bool
+	}{
+		{"just created", 0, false},
+		{"waiting for health", docker.HealthTimeout, false},
+		{"past the grace", startGrace + time.Second, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, orphans := mismatches(nil, []docker.Container{
+				{Name: "ws_" + id.String(), CreatedAt: now.Add(-tt.age)},
+			}, now)
+			if _, ok := orphans[id]; ok != tt.orphan {
+				t.Errorf("orphaned = %v, want %v", ok, tt.orphan)
+			}
+		})
+	}
+}
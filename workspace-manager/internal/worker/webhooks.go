@@ -0,0 +1,239 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	db "example.com/m/v2/db/sqlc"
+	"example.com/m/v2/internal/logging"
+	"example.com/m/v2/internal/metrics"
+	"example.com/m/v2/internal/webhook"
+)
+
+const (
+	// webhookBatch is how many deliveries are claimed, and sent in
+	// parallel, at once.
+	webhookBatch = 20
+
+	webhookTimeout = 10 * time.Second
+
+	// a delivery is retried after 30s, 1m, 2m and so on up to the cap, and
+	// given up after webhookMaxAttempts, some four hours in
+	webhookBaseBackoff = 30 * time.Second
+	webhookMaxBackoff  = 6 * time.Hour
+	webhookMaxAttempts = 10
+
+	// how long finished deliveries stay in the delivery log
+	webhookRetention = 30 * 24 * time.Hour
+)
+
+// WebhookWorker sends queued webhook deliveries and retries failed ones with
+// exponential backoff.
+//
+// ClaimWebhookDeliveries leases what it claims for five minutes; a delivery
+// whose worker dies mid-send is sent again once the lease runs out. Receivers
+// tell repeats apart by the delivery ID.
+type WebhookWorker struct {
+	q         *db.Queries
+	client    *http.Client
+	heartbeat *Heartbeat
+	lastPurge time.Time
+}
+
+// NewWebhookWorker returns the worker. Unless allowPrivate is set it refuses
+// to connect to loopback, private and link-local addresses.
+func NewWebhookWorker(q *db.Queries, allowPrivate bool) *WebhookWorker {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !allowPrivate {
+		dialer.Control = publicOnly
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+
+	return &WebhookWorker{
+		q: q,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   webhookTimeout,
+			// a redirect is a failed delivery, not a new destination
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		heartbeat: newHeartbeat("webhooks", 5*time.Minute),
+	}
+}
+
+func (w *WebhookWorker) Heartbeat() *Heartbeat {
+	return w.heartbeat
+}
+
+func (w *WebhookWorker) Start(ctx context.Context, wg *sync.WaitGroup) {
+	ticker := time.NewTicker(5 * time.Second)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-ticker.C:
+				w.heartbeat.beat()
+				w.runOnce(ctx)
+			case <-ctx.Done():
+				ticker.Stop()
+				w.heartbeat.stop()
+				return
+			}
+		}
+	}()
+}
+
+func (w *WebhookWorker) runOnce(ctx context.Context) {
+	ctx = logging.WithOperation(ctx, slog.String("worker", "webhooks"))
+
+	if time.Since(w.lastPurge) > time.Hour {
+		w.lastPurge = time.Now()
+		if _, err := w.q.DeleteOldWebhookDeliveries(ctx, time.Now().Add(-webhookRetention)); err != nil {
+			slog.ErrorContext(ctx, "deleting old webhook deliveries failed", "error", err)
+		}
+	}
+
+	for ctx.Err() == nil {
+		w.heartbeat.beat()
+
+		due, err := w.q.ClaimWebhookDeliveries(ctx, webhookBatch)
+		if err != nil {
+			slog.ErrorContext(ctx, "claiming webhook deliveries failed", "error", err)
+			return
+		}
+		if len(due) == 0 {
+			return
+		}
+
+		var sends sync.WaitGroup
+		for _, d := range due {
+			sends.Add(1)
+			go func() {
+				defer sends.Done()
+				w.deliver(ctx, d)
+			}()
+		}
+		sends.Wait()
+	}
+}
+
+func (w *WebhookWorker) deliver(ctx context.Context, d db.ClaimWebhookDeliveriesRow) {
+	ctx = logging.With(ctx,
+		slog.String("webhook_id", d.WebhookID.String()),
+		slog.String("delivery_id", d.ID.String()),
+	)
+
+	status, err := w.send(ctx, d)
+	if err != nil && ctx.Err() != nil {
+		// shutting down: the lease runs out and it is sent again
+		return
+	}
+
+	if err == nil {
+		if err := w.q.CompleteWebhookDelivery(ctx, db.CompleteWebhookDeliveryParams{
+			ID:             d.ID,
+			ResponseStatus: status,
+		}); err != nil {
+			slog.ErrorContext(ctx, "completing webhook delivery failed", "error", err)
+		}
+		metrics.WebhookDeliveries.WithLabelValues("delivered").Inc()
+		return
+	}
+
+	if d.Attempts >= webhookMaxAttempts {
+		slog.WarnContext(ctx, "giving up on webhook delivery", "attempts", d.Attempts, "error", err)
+		if err := w.q.FailWebhookDelivery(ctx, db.FailWebhookDeliveryParams{
+			ID:             d.ID,
+			ResponseStatus: status,
+			Error:          err.Error(),
+		}); err != nil {
+			slog.ErrorContext(ctx, "recording webhook delivery failure failed", "error", err)
+		}
+		metrics.WebhookDeliveries.WithLabelValues("failed").Inc()
+		return
+	}
+
+	retry := webhookBackoff(d.Attempts)
+	slog.InfoContext(ctx, "webhook delivery failed, will retry", "attempts", d.Attempts, "retry_in", retry.String(), "error", err)
+	if err := w.q.RetryWebhookDelivery(ctx, db.RetryWebhookDeliveryParams{
+		ID:             d.ID,
+		ResponseStatus: status,
+		Error:          err.Error(),
+		NextAttemptAt:  time.Now().Add(retry),
+	}); err != nil {
+		slog.ErrorContext(ctx, "scheduling webhook retry failed", "error", err)
+	}
+	metrics.WebhookDeliveries.WithLabelValues("retried").Inc()
+}
+
+// send posts the payload. Any 2xx response counts as delivered. The
+// response status is returned whenever the receiver answered.
+func (w *WebhookWorker) send(ctx context.Context, d db.ClaimWebhookDeliveriesRow) (sql.NullInt32, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.Url, bytes.NewReader(d.Payload))
+	if err != nil {
+		return sql.NullInt32{}, err
+	}
+
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ambilio-webhooks")
+	req.Header.Set("X-Webhook-Event", d.Event)
+	req.Header.Set("X-Webhook-Delivery", d.ID.String())
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set("X-Webhook-Signature", webhook.Sign(d.Secret, now, d.Payload))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return sql.NullInt32{}, err
+	}
+	defer resp.Body.Close()
+	// read a little so the connection can be reused; the body is ignored
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	status := sql.NullInt32{Int32: int32(resp.StatusCode), Valid: true}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return status, fmt.Errorf("receiver responded %s", resp.Status)
+	}
+	return status, nil
+}
+
+// webhookBackoff is the wait before retrying after the given number of
+// failed attempts.
+func webhookBackoff(attempts int32) time.Duration {
+	d := webhookBaseBackoff
+	for i := int32(1); i < attempts && d < webhookMaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, webhookMaxBackoff)
+}
+
+// publicOnly is a dialer Control that refuses non-public addresses, so a
+// webhook cannot reach the manager's own network, such as the database or
+// the cloud metadata endpoint. It sees the address after DNS resolution, so
+// a name that resolves inward is caught too.
+func publicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return fmt.Errorf("webhook address %s is not public", host)
+	}
+	return nil
+}
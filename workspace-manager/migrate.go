@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"example.com/m/v2/db/migrations"
+)
+
+const migrateUsage = `usage: workspace-manager [flags] migrate <command>
+
+  up          apply all pending migrations
+  down [n]    roll back the last n migrations (default 1)
+  status      list migrations and whether they are applied
+  force <v>   record the schema as being at version v without running SQL,
+              e.g. to adopt a database created from the old schema.sql`
+
+// runMigrate implements the migrate subcommand.
+func runMigrate(ctx context.Context, conn *sql.DB, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		done, err := migrations.Up(ctx, conn)
+		for _, m := range done {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(done) == 0 {
+			fmt.Println("no pending migrations")
+		}
+		return nil
+
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			var err error
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+				return errors.New(migrateUsage)
+			}
+		}
+		done, err := migrations.Down(ctx, conn, n)
+		for _, m := range done {
+			fmt.Printf("rolled back %04d_%s\n", m.Version, m.Name)
+		}
+		return err
+
+	case "status":
+		states, err := migrations.Status(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, s := range states {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Printf("%04d_%-40s %s\n", s.Version, s.Name, applied)
+		}
+		return nil
+
+	case "force":
+		if len(args) != 2 {
+			return errors.New(migrateUsage)
+		}
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return errors.New(migrateUsage)
+		}
+		if err := migrations.Force(ctx, conn, version); err != nil {
+			return err
+		}
+		fmt.Printf("schema recorded at version %d\n", version)
+		return nil
+	}
+
+	return errors.New(migrateUsage)
+}
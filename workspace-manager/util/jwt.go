@@ -1,25 +1,92 @@
 package util
 
 import (
+  "errors"
+  "log/slog"
   "time"
   "github.com/golang-jwt/jwt/v5"
-  "os"
 )
 
-var jwtSecret = []byte(func() string { if s:=os.Getenv("JWT_SECRET"); s!="" {return s}; return "dev-secret" }())
+// signingKeys is set once at startup by InitSigningKeys.
+var signingKeys *KeyRing
 
-func GenerateJWT(userID string) (string, error) {
-  t := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-    "sub": userID, "exp": time.Now().Add(24*time.Hour).Unix(),
+// InitSigningKeys loads the token signing keys. Production refuses to start
+// without a key directory, since ephemeral keys would log everyone out on
+// every restart and differ between replicas.
+func InitSigningKeys(cfg *Config) (*KeyRing, error) {
+  if cfg.JWTKeyDir == "" {
+    if cfg.IsProduction() { return nil, errors.New("JWT_KEY_DIR must be set in production") }
+    slog.Warn("JWT_KEY_DIR not set, using an ephemeral signing key")
+  }
+  kr, err := LoadKeyRing(cfg.JWTKeyDir, cfg.JWTAlg)
+  if err != nil { return nil, err }
+  signingKeys = kr
+  return kr, nil
+}
+
+// Access tokens are short-lived; sessions are kept alive with rotating
+// refresh tokens instead.
+const (
+  AccessTokenTTL  = 15*time.Minute
+  RefreshTokenTTL = 30*24*time.Hour
+)
+
+// Claims are the access token claims. The subject is the user ID; SessionID
+// is the login session the token belongs to, so revoking it ends the token
+// early; OrgID is the organization the session is acting in, empty for
+// personal use; Role is the user's platform role when the token was issued.
+type Claims struct {
+  SessionID string `json:"sid"`
+  OrgID string `json:"org_id,omitempty"`
+  Role  string `json:"role"`
+  jwt.RegisteredClaims
+}
+
+func GenerateJWT(userID, sessionID, orgID, role string) (string, error) {
+  return signingKeys.sign(Claims{
+    SessionID: sessionID,
+    OrgID: orgID,
+    Role:  role,
+    RegisteredClaims: jwt.RegisteredClaims{
+      Subject: userID, ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
+    },
   })
-  return t.SignedString(jwtSecret)
 }
 
-func ParseJWT(tokenStr string) (string, error) {
-  t, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) { return jwtSecret, nil })
-  if err != nil { return "", err }
-  if claims, ok := t.Claims.(jwt.MapClaims); ok && t.Valid {
-    return claims["sub"].(string), nil
-  }
-  return "", err
+func ParseJWT(tokenStr string) (*Claims, error) {
+  claims := &Claims{}
+  // pinning the methods rejects alg=none and HMAC-with-public-key tricks
+  t, err := jwt.ParseWithClaims(tokenStr, claims, signingKeys.verificationKey, jwt.WithValidMethods([]string{AlgRS256, AlgEdDSA}))
+  if err != nil { return nil, err }
+  if !t.Valid { return nil, jwt.ErrTokenInvalidClaims }
+  // download links are signed with the same keys but always carry an audience
+  if len(claims.Audience) > 0 { return nil, jwt.ErrTokenInvalidAudience }
+  return claims, nil
+}
+
+// DownloadTTL bounds signed download links. Keys are only kept for
+// AccessTokenTTL after rotation, so links cannot outlive that either.
+const DownloadTTL = AccessTokenTTL
+
+const downloadAudience = "download"
+
+// SignDownload returns a token that on its own authorizes downloading
+// resource, for links handed to browsers.
+func SignDownload(resource string) (string, error) {
+  return signingKeys.sign(jwt.RegisteredClaims{
+    Subject: resource,
+    Audience: jwt.ClaimStrings{downloadAudience},
+    ExpiresAt: jwt.NewNumericDate(time.Now().Add(DownloadTTL)),
+  })
+}
+
+// VerifyDownload reports whether token was issued by SignDownload for
+// resource and has not expired.
+func VerifyDownload(token, resource string) bool {
+  _, err := jwt.ParseWithClaims(token, &jwt.RegisteredClaims{}, signingKeys.verificationKey,
+    jwt.WithValidMethods([]string{AlgRS256, AlgEdDSA}),
+    jwt.WithAudience(downloadAudience),
+    jwt.WithSubject(resource),
+  )
+  return err == nil
 }
@@ -0,0 +1,341 @@
+package util
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+
+	// unknown kids trigger a reload at most this often, so keys rotated by
+	// another replica are picked up without letting bad tokens hammer the disk
+	keyReloadBackoff = 10 * time.Second
+)
+
+type signingKey struct {
+	kid       string
+	alg       string
+	private   crypto.Signer
+	createdAt time.Time
+}
+
+// KeyRing holds the token signing keys. The newest key signs; older keys
+// only verify, until every token they could have signed has expired.
+//
+// Keys are PKCS#8 PEM files in dir named <kid>.pem, so replicas sharing the
+// directory share keys. Without a dir an ephemeral key is generated, which
+// is only acceptable outside production.
+type KeyRing struct {
+	dir string
+	alg string
+
+	mu         sync.RWMutex
+	keys       []signingKey
+	reloadedAt time.Time
+}
+
+// LoadKeyRing reads the keys in dir, generating and saving a first one when
+// it is empty. alg is used for keys generated here.
+func LoadKeyRing(dir, alg string) (*KeyRing, error) {
+	if alg != AlgRS256 && alg != AlgEdDSA {
+		return nil, fmt.Errorf("unsupported jwt algorithm %q", alg)
+	}
+
+	kr := &KeyRing{dir: dir, alg: alg}
+	if err := kr.Reload(); err != nil {
+		return nil, err
+	}
+
+	if len(kr.keys) == 0 {
+		if err := kr.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return kr, nil
+}
+
+// Persistent reports whether keys are kept on disk rather than in memory.
+func (kr *KeyRing) Persistent() bool {
+	return kr.dir != ""
+}
+
+// Reload re-reads the key directory.
+func (kr *KeyRing) Reload() error {
+	if kr.dir == "" {
+		return nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(kr.dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+
+	keys := make([]signingKey, 0, len(paths))
+	for _, path := range paths {
+		k, err := readKey(path)
+		if err != nil {
+			return fmt.Errorf("jwt key %s: %w", path, err)
+		}
+		keys = append(keys, k)
+	}
+	sortKeys(keys)
+
+	kr.mu.Lock()
+	kr.keys, kr.reloadedAt = keys, time.Now()
+	kr.mu.Unlock()
+
+	return nil
+}
+
+// Rotate generates a new signing key and retires keys that can no longer
+// have signed an unexpired token.
+func (kr *KeyRing) Rotate() error {
+	k, err := generateKey(kr.alg)
+	if err != nil {
+		return err
+	}
+
+	if kr.dir != "" {
+		if err := writeKey(filepath.Join(kr.dir, k.kid+".pem"), k.private); err != nil {
+			return err
+		}
+	}
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	kr.keys = append([]signingKey{k}, kr.keys...)
+
+	// a key stops signing when the next one is created, so its tokens
+	// are all expired AccessTokenTTL after that
+	kept := kr.keys[:1]
+	for i := 1; i < len(kr.keys); i++ {
+		if time.Since(kr.keys[i-1].createdAt) < AccessTokenTTL {
+			kept = append(kept, kr.keys[i])
+			continue
+		}
+		if kr.dir != "" {
+			if err := os.Remove(filepath.Join(kr.dir, kr.keys[i].kid+".pem")); err != nil && !errors.Is(err, os.ErrNotExist) {
+				slog.Warn("removing retired jwt key failed", "kid", kr.keys[i].kid, "error", err)
+			}
+		}
+	}
+	kr.keys = kept
+
+	return nil
+}
+
+// SignerAge is how long the current signing key has been in use.
+func (kr *KeyRing) SignerAge() time.Duration {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	if len(kr.keys) == 0 {
+		return 0
+	}
+	return time.Since(kr.keys[0].createdAt)
+}
+
+func (kr *KeyRing) sign(claims jwt.Claims) (string, error) {
+	kr.mu.RLock()
+	if len(kr.keys) == 0 {
+		kr.mu.RUnlock()
+		return "", errors.New("no jwt signing key")
+	}
+	k := kr.keys[0]
+	kr.mu.RUnlock()
+
+	t := jwt.NewWithClaims(jwt.GetSigningMethod(k.alg), claims)
+	t.Header["kid"] = k.kid
+	return t.SignedString(k.private)
+}
+
+// verificationKey is the jwt.Keyfunc for tokens signed by the ring.
+func (kr *KeyRing) verificationKey(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no kid")
+	}
+
+	k, ok := kr.find(kid)
+	if !ok {
+		kr.mu.RLock()
+		stale := time.Since(kr.reloadedAt) > keyReloadBackoff
+		kr.mu.RUnlock()
+
+		if stale {
+			if err := kr.Reload(); err != nil {
+				return nil, err
+			}
+			k, ok = kr.find(kid)
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+
+	if t.Method.Alg() != k.alg {
+		return nil, fmt.Errorf("kid %q is not an %s key", kid, t.Method.Alg())
+	}
+
+	return k.private.Public(), nil
+}
+
+func (kr *KeyRing) find(kid string) (signingKey, bool) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	for _, k := range kr.keys {
+		if k.kid == kid {
+			return k, true
+		}
+	}
+	return signingKey{}, false
+}
+
+// JWK is a public key in JSON Web Key form.
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS returns the public halves of every key that may have signed a
+// still-valid token.
+func (kr *KeyRing) JWKS() []JWK {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	out := make([]JWK, 0, len(kr.keys))
+	for _, k := range kr.keys {
+		jwk := JWK{Use: "sig", Alg: k.alg, Kid: k.kid}
+
+		switch pub := k.private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+
+		out = append(out, jwk)
+	}
+	return out
+}
+
+func generateKey(alg string) (signingKey, error) {
+	now := time.Now()
+	k := signingKey{
+		// sortable, so a directory listing shows the rotation order
+		kid:       now.UTC().Format("20060102T150405Z") + "-" + randomSuffix(),
+		alg:       alg,
+		createdAt: now,
+	}
+
+	var err error
+	switch alg {
+	case AlgRS256:
+		k.private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgEdDSA:
+		_, k.private, err = ed25519.GenerateKey(rand.Reader)
+	}
+	return k, err
+}
+
+func randomSuffix() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("%x", b)
+}
+
+func readKey(path string) (signingKey, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return signingKey{}, err
+	}
+
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return signingKey{}, errors.New("not a PEM file")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return signingKey{}, err
+	}
+
+	k := signingKey{kid: strings.TrimSuffix(filepath.Base(path), ".pem")}
+
+	switch priv := parsed.(type) {
+	case *rsa.PrivateKey:
+		k.alg, k.private = AlgRS256, priv
+	case ed25519.PrivateKey:
+		k.alg, k.private = AlgEdDSA, priv
+	default:
+		return signingKey{}, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return signingKey{}, err
+	}
+	k.createdAt = info.ModTime()
+
+	return k, nil
+}
+
+func writeKey(path string, key crypto.Signer) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	// write then rename so other replicas never read a partial key
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// sortKeys orders keys newest first.
+func sortKeys(keys []signingKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].createdAt.Equal(keys[j].createdAt) {
+			return keys[i].createdAt.After(keys[j].createdAt)
+		}
+		return keys[i].kid > keys[j].kid
+	})
+}
@@ -0,0 +1,248 @@
+package util
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// useKeyRing makes kr the package's signing keys for the rest of the test.
+func useKeyRing(t *testing.T, kr *KeyRing) {
+	t.Helper()
+	prev := signingKeys
+	signingKeys = kr
+	t.Cleanup(func() { signingKeys = prev })
+}
+
+func newKeyRing(t *testing.T, dir, alg string) *KeyRing {
+	t.Helper()
+	kr, err := LoadKeyRing(dir, alg)
+	if err != nil {
+		t.Fatalf("LoadKeyRing: %v", err)
+	}
+	return kr
+}
+
+func TestParseJWTRoundTrip(t *testing.T) {
+	for _, alg := range []string{AlgRS256, AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			useKeyRing(t, newKeyRing(t, "", alg))
+
+			token, err := GenerateJWT("user-1", "session-1", "org-1", "admin")
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := ParseJWT(token)
+			if err != nil {
+				t.Fatalf("ParseJWT: %v", err)
+			}
+			if claims.Subject != "user-1" || claims.SessionID != "session-1" || claims.OrgID != "org-1" || claims.Role != "admin" {
+				t.Errorf("claims = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestParseJWTRejects(t *testing.T) {
+	kr := newKeyRing(t, "", AlgEdDSA)
+	useKeyRing(t, kr)
+	k := kr.keys[0]
+
+	signed := func(method jwt.SigningMethod, kid string, key any, claims jwt.Claims) string {
+		t.Helper()
+		tok := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			tok.Header["kid"] = kid
+		}
+		s, err := tok.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	valid := Claims{RegisteredClaims: jwt.RegisteredClaims{
+		Subject:   "user-1",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}}
+	expired := Claims{RegisteredClaims: jwt.RegisteredClaims{
+		Subject:   "user-1",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+	}}
+	_, stranger, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	download, err := SignDownload("export-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"expired", signed(jwt.SigningMethodEdDSA, k.kid, k.private, expired)},
+		{"no kid", signed(jwt.SigningMethodEdDSA, "", k.private, valid)},
+		{"unknown kid", signed(jwt.SigningMethodEdDSA, "nope", k.private, valid)},
+		{"foreign key", signed(jwt.SigningMethodEdDSA, k.kid, stranger, valid)},
+		{"alg none", signed(jwt.SigningMethodNone, k.kid, jwt.UnsafeAllowNoneSignatureType, valid)},
+		{"hmac", signed(jwt.SigningMethodHS256, k.kid, []byte("secret"), valid)},
+		{"download link", download},
+		{"garbage", "not.a.token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseJWT(tt.token); err == nil {
+				t.Error("ParseJWT accepted the token")
+			}
+		})
+	}
+}
+
+func TestVerifyDownload(t *testing.T) {
+	useKeyRing(t, newKeyRing(t, "", AlgEdDSA))
+
+	link, err := SignDownload("export-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	access, err := GenerateJWT("export-1", "session-1", "", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		resource string
+		want     bool
+	}{
+		{"matching resource", link, "export-1", true},
+		{"other resource", link, "export-2", false},
+		{"access token", access, "export-1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyDownload(tt.token, tt.resource); got != tt.want {
+				t.Errorf("VerifyDownload = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRotateKeepsRecentKeys(t *testing.T) {
+	kr := newKeyRing(t, t.TempDir(), AlgEdDSA)
+	useKeyRing(t, kr)
+
+	before, err := GenerateJWT("user-1", "session-1", "", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKid := kr.keys[0].kid
+
+	if err := kr.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if kr.keys[0].kid == oldKid {
+		t.Fatal("Rotate kept signing with the old key")
+	}
+
+	// tokens from the previous key stay valid until they expire
+	if _, err := ParseJWT(before); err != nil {
+		t.Errorf("token signed before rotation rejected: %v", err)
+	}
+	after, err := GenerateJWT("user-1", "session-1", "", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, _, err := jwt.NewParser().ParseUnverified(after, &Claims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.Header["kid"] != kr.keys[0].kid {
+		t.Errorf("new token kid = %v, want %s", tok.Header["kid"], kr.keys[0].kid)
+	}
+
+	kids := map[string]bool{}
+	for _, jwk := range kr.JWKS() {
+		kids[jwk.Kid] = true
+	}
+	if !kids[oldKid] || !kids[kr.keys[0].kid] {
+		t.Errorf("JWKS kids = %v, want both %s and %s", kids, oldKid, kr.keys[0].kid)
+	}
+}
+
+func TestRotateRetiresExpiredKeys(t *testing.T) {
+	kr := newKeyRing(t, t.TempDir(), AlgEdDSA)
+	useKeyRing(t, kr)
+
+	before, err := GenerateJWT("user-1", "session-1", "", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKid := kr.keys[0].kid
+
+	if err := kr.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := kr.find(oldKid); !ok {
+		t.Fatalf("key %s retired while its tokens may be valid", oldKid)
+	}
+
+	// its replacement has signed for longer than a token lives, so nothing
+	// the old key signed can still be valid
+	kr.keys[0].createdAt = time.Now().Add(-2 * AccessTokenTTL)
+	if err := kr.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := kr.find(oldKid); ok {
+		t.Errorf("retired key %s still in the ring", oldKid)
+	}
+	// the file is gone too, so a reload does not bring it back
+	kr.reloadedAt = time.Time{}
+	if _, err := ParseJWT(before); err == nil {
+		t.Error("token from a retired key accepted")
+	}
+}
+
+func TestKeyRingSharedDir(t *testing.T) {
+	dir := t.TempDir()
+	first := newKeyRing(t, dir, AlgRS256)
+	second := newKeyRing(t, dir, AlgRS256)
+
+	if first.keys[0].kid != second.keys[0].kid {
+		t.Fatalf("replicas sharing a dir use different keys: %s, %s", first.keys[0].kid, second.keys[0].kid)
+	}
+
+	// a key rotated by one replica is picked up by the other once the
+	// reload backoff has passed
+	if err := second.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	useKeyRing(t, second)
+	token, err := GenerateJWT("user-1", "session-1", "", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	useKeyRing(t, first)
+	if _, err := ParseJWT(token); err == nil {
+		t.Error("unknown kid accepted within the reload backoff")
+	}
+	first.reloadedAt = time.Now().Add(-2 * keyReloadBackoff)
+	if _, err := ParseJWT(token); err != nil {
+		t.Errorf("rotated key not picked up after reload: %v", err)
+	}
+}
+
+func TestLoadKeyRingRejectsAlg(t *testing.T) {
+	if _, err := LoadKeyRing("", "HS256"); err == nil {
+		t.Error("LoadKeyRing accepted HS256")
+	}
+}